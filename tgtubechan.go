@@ -18,26 +18,47 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math"
 	"math/rand"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
+	_ "time/tzdata"
 
 	"image"
-	_ "image/jpeg"
+	"image/jpeg"
 	"image/png"
 
 	"golang.org/x/exp/slices"
+	xdraw "golang.org/x/image/draw"
 	_ "golang.org/x/image/webp"
 
 	yaml "github.com/goccy/go-yaml"
@@ -56,18 +77,138 @@ const (
 
 	TgUpdateLogMaxSizeDefault = 12
 
+	ConfigPutRetries = 3
+
+	WorkersDefault = 1
+
+	// seconds of getUpdates long polling
+	TgGetUpdatesTimeout = 50
+
 	IntervalDefault        = "1m11s"
 	YtCheckIntervalDefault = "1h11m11s"
 
+	YtLookbackDefault = 7 * 24 * time.Hour
+
+	TgEditIntervalDefault = time.Hour
+	YtRetryMaxDefault     = 3
+	YtLedgerKeepDefault   = 31 * 24 * time.Hour
+
+	YtSourceApi  = "api"
+	YtSourceFeed = "feed"
+
+	// https://www.youtube.com/feeds/videos.xml?channel_id=
+	YtFeedUrl = "https://www.youtube.com/feeds/videos.xml"
+	// the channel feed has this many latest videos
+	YtFeedEntriesMax = 15
+
+	// https://pubsubhubbub.appspot.com/
+	WebSubHubUrl   = "https://pubsubhubbub.appspot.com/subscribe"
+	WebSubTopicUrl = "https://www.youtube.com/xml/feeds/videos.xml"
+
+	WebSubLeaseDefault = 5 * 24 * time.Hour
+	// leases are renewed this long before they expire
+	WebSubRenewBefore = 24 * time.Hour
+	// subscription requests not verified by the hub are repeated after this
+	WebSubRetryInterval = time.Hour
+
+	TgModeAudio = "audio"
+	TgModeVideo = "video"
+	TgModeBoth  = "both"
+
+	TgAudioCodecAac  = "aac"
+	TgAudioCodecOpus = "opus"
+	TgAudioCodecMp3  = "mp3"
+	// the downloaded youtube audio as it is
+	TgAudioCodecCopy = "copy"
+
+	// the center square of the thumbnail
+	TgCoverCrop = "crop"
+	// the whole thumbnail over its blurred center square
+	TgCoverBlur = "blur"
+	// the youtube channel avatar, the crop when there is none
+	TgCoverAvatar = "avatar"
+
+	// https://core.telegram.org/bots/api#sendaudio thumbnail jpeg less than 200kb and 320x320
+	TgThumbSize      = 320
+	TgThumbSizeMaxKb = 200
+
+	// the channels avatars are got again after this
+	YtAvatarKeep = 24 * time.Hour
+
+	// https://ffmpeg.org/ffmpeg-filters.html#loudnorm
+	LoudnormLufsMin  = -70
+	LoudnormLufsMax  = -5
+	LoudnormTruePeak = -1.5
+	LoudnormRange    = 11
+
+	TgVideoHeightMaxDefault = 720
+	// https://core.telegram.org/bots/api#sendaudio caption 0-1024 characters
+	TgCaptionSizeMax       = 1024
+	TgMessageSizeMax       = 4096
+	TgFileSizeMaxMbDefault = 50
+
+	VideoPending           = "pending"
+	VideoPosted            = "posted"
+	VideoSkippedUnplayable = "skipped-unplayable"
+	VideoSkippedAge        = "skipped-age"
+	VideoFailed            = "failed"
+	VideoRemoved           = "removed"
+
+	TgMessagePhoto       = "photo"
+	TgMessageAudio       = "audio"
+	TgMessageVideo       = "video"
+	TgMessageDescription = "description"
+	TgMessageNotice      = "notice"
+
+	// the removed videos are reported to the Config.TgChatId log chat
+	TgRemovedReport = "report"
+	// and the note is added to the captions of the posts
+	TgRemovedNote = "note"
+	// and the posts are deleted
+	TgRemovedDelete = "delete"
+
+	TgRemovedNoteText = "removed from youtube"
+	// TgRemovedNoteCaption is added to the captions of the posts of the removed videos
+	TgRemovedNoteCaption = NL + NL + "_" + TgRemovedNoteText + "_"
+
 	MsgEmbeddingDisabled = "embedding of this video has been disabled"
 	MsgLoginRequired     = "login required to confirm your age"
 )
 
-type TgTubeChanChannel struct {
+// TgTubeChanSource is a youtube channel or playlist of a channel with Sources,
+// the fields not set are taken from the channel
+type TgTubeChanSource struct {
 	YtUsername   string `yaml:"YtUsername"`
 	YtChannelId  string `yaml:"YtChannelId"`
 	YtPlaylistId string `yaml:"YtPlaylistId"`
-	YtLast       string `yaml:"YtLast"`
+	YtLast       string `yaml:"YtLast,omitempty"`
+	YtSource     string `yaml:"YtSource"`
+
+	TgPerformer    string `yaml:"TgPerformer"`
+	TgTitleCleanRe string `yaml:"TgTitleCleanRe"`
+	TgTitleUnquote bool   `yaml:"TgTitleUnquote"`
+}
+
+// TgTubeChanDestination is a telegram chat the channel videos are posted to
+type TgTubeChanDestination struct {
+	TgChatId          string `yaml:"TgChatId"`
+	TgSkipPhoto       bool   `yaml:"TgSkipPhoto"`
+	TgSkipDescription bool   `yaml:"TgSkipDescription"`
+}
+
+type TgTubeChanChannel struct {
+	Name string `yaml:"Name"` // = YtUsername or YtPlaylistId, the channel key in the state and the commands, required with Sources
+
+	YtUsername   string `yaml:"YtUsername"`
+	YtChannelId  string `yaml:"YtChannelId"`
+	YtPlaylistId string `yaml:"YtPlaylistId"`     // the channel uploads by default, any playlist to mirror it without YtUsername
+	YtLast       string `yaml:"YtLast,omitempty"` // legacy, only seeds the channel state
+
+	YtCheckInterval time.Duration `yaml:"YtCheckInterval"` // = Config.YtCheckInterval
+
+	YtSource string `yaml:"YtSource"` // YtSourceApi "api" YtSourceFeed "feed", the feed saves the YtKey quota
+
+	Sources []TgTubeChanSource `yaml:"Sources"` // merged in publish order instead of the channel own YtUsername or YtPlaylistId
 
 	TgChatId          string `yaml:"TgChatId"`
 	TgPerformer       string `yaml:"TgPerformer"`
@@ -76,29 +217,64 @@ type TgTubeChanChannel struct {
 	TgSkipPhoto       bool   `yaml:"TgSkipPhoto"`
 	TgSkipDescription bool   `yaml:"TgSkipDescription"`
 
+	TgDestinations []TgTubeChanDestination `yaml:"TgDestinations"` // posted to besides TgChatId reusing the uploaded files
+
+	// text/template of TgTubeChanCaption rendering MarkdownV2, the defaults when empty
+	TgPhotoCaptionTemplate string `yaml:"TgPhotoCaptionTemplate"` // TgPhotoCaptionTemplateDefault
+	TgAudioCaptionTemplate string `yaml:"TgAudioCaptionTemplate"` // TgAudioCaptionTemplateDefault, also the video caption
+	TgDescriptionTemplate  string `yaml:"TgDescriptionTemplate"`  // TgDescriptionTemplateDefault
+
+	TgMode           string  `yaml:"TgMode"`           // TgModeAudio "audio" TgModeVideo "video" TgModeBoth "both"
+	TgChapterPosts   bool    `yaml:"TgChapterPosts"`   // post the description chapters as separate audios instead of the whole audio
+	TgAudioCodec     string  `yaml:"TgAudioCodec"`     // TgAudioCodecAac "aac" TgAudioCodecOpus "opus" TgAudioCodecMp3 "mp3" TgAudioCodecCopy "copy"
+	TgCoverMode      string  `yaml:"TgCoverMode"`      // TgCoverCrop "crop" TgCoverBlur "blur" TgCoverAvatar "avatar" of the square audio thumb
+	TgLoudnessLufs   float64 `yaml:"TgLoudnessLufs"`   // -16 two-pass ebu r128 loudnorm target, 0 to keep the loudness
+	TgVideoHeightMax int     `yaml:"TgVideoHeightMax"` // TgVideoHeightMaxDefault 720
+	TgRemovedMode    string  `yaml:"TgRemovedMode"`    // TgRemovedReport "report" TgRemovedNote "note" TgRemovedDelete "delete" the posts of the videos removed from youtube
+
 	Suspend bool `yaml:"Suspend"`
 }
 
 type TgTubeChanConfig struct {
-	YssUrl string `yaml:"-"`
+	YssUrl     string `yaml:"-"`
+	ConfigPath string `yaml:"-"`
 
 	DEBUG bool `yaml:"DEBUG"`
 
 	Interval time.Duration `yaml:"Interval"`
 
+	Workers       int `yaml:"Workers"`       // WorkersDefault 1, channels processed in parallel, read once at start
+	DownloadsMax  int `yaml:"DownloadsMax"`  // = Workers, concurrent youtube downloads, read once at start
+	FfmpegRunsMax int `yaml:"FfmpegRunsMax"` // = Workers, concurrent ffmpeg runs, read once at start
+
 	TgApiUrl string `yaml:"TgApiUrl"` // "https://api.telegram.org" "http://tgbotserver:80"
 
 	TgToken  string `yaml:"TgToken"`
 	TgChatId string `yaml:"TgChatId"`
 	TgBossId string `yaml:"TgBossId"`
 
-	TgUpdateLog        []int64 `yaml:"TgUpdateLog,flow"`
-	TgUpdateLogMaxSize int     `yaml:"TgUpdateLogMaxSize"` // = 12
+	TgAdminIds []string `yaml:"TgAdminIds,flow"` // users allowed to send commands besides TgBossId
+
+	HttpListen string `yaml:"HttpListen"` // ":8080"
+
+	TgWebhookUrl    string `yaml:"TgWebhookUrl"`    // "https://tgtubechan.example.org/tgwebhook" empty to poll with getUpdates, read once at start
+	TgWebhookSecret string `yaml:"TgWebhookSecret"` // X-Telegram-Bot-Api-Secret-Token header value
+
+	WebSubUrl    string        `yaml:"WebSubUrl"`    // "https://tgtubechan.example.org/websub" empty to only poll, read once at start
+	WebSubSecret string        `yaml:"WebSubSecret"` // hub.secret signing the notifications
+	WebSubLease  time.Duration `yaml:"WebSubLease"`  // WebSubLeaseDefault 120h
+
+	TgUpdateLog        []int64 `yaml:"TgUpdateLog,flow,omitempty"` // legacy, only seeds the state
+	TgUpdateLogMaxSize int     `yaml:"TgUpdateLogMaxSize"`         // = 12
 
 	TgPlaylistVideosInterval time.Duration `yaml:"TgPlaylistVideosInterval"`
 
 	TgAudioBitrateKbps int64 `yaml:"TgAudioBitrateKbps"` // 60
 
+	TgFileSizeMaxMb int64 `yaml:"TgFileSizeMaxMb"` // TgFileSizeMaxMbDefault 50, 2000 with a local bot api server
+
+	TgTimezone string `yaml:"TgTimezone"` // "Europe/Berlin" of the captions PublishedAt, UTC when empty
+
 	DssUrl string `yaml:"DssUrl"` // "http://dss:80"
 
 	YtKey        string `yaml:"YtKey"`
@@ -106,7 +282,14 @@ type TgTubeChanConfig struct {
 	YtThrottle   int64  `yaml:"YtThrottle"`   // 12
 
 	YtCheckInterval time.Duration `yaml:"YtCheckInterval"` // YtCheckIntervalDefault 1h11m11s
-	YtCheckLast     time.Time     `yaml:"YtCheckLast"`
+
+	YtLookback   time.Duration `yaml:"YtLookback"`   // YtLookbackDefault 168h
+	YtRetryMax   int           `yaml:"YtRetryMax"`   // YtRetryMaxDefault 3
+	YtLedgerKeep time.Duration `yaml:"YtLedgerKeep"` // YtLedgerKeepDefault 744h
+
+	TgEditWindow    time.Duration `yaml:"TgEditWindow"`    // 72h, the posts of the videos published this recently are edited when the videos change, 0 to not edit
+	TgRemovedWindow time.Duration `yaml:"TgRemovedWindow"` // 72h, the videos published this recently are checked for removal by the channels TgRemovedMode, 0 to not check
+	TgEditInterval  time.Duration `yaml:"TgEditInterval"`  // TgEditIntervalDefault 1h, how often the recent videos are checked for changes and removal
 
 	YtUserAgent string `yaml:"YtUserAgent"` // "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.6 Safari/605.1.15"
 
@@ -116,20 +299,137 @@ type TgTubeChanConfig struct {
 	Channels []TgTubeChanChannel `yaml:"Channels"`
 }
 
+// TgTubeChanVideo is the ledger entry of a video
+type TgTubeChanVideo struct {
+	Status      string `yaml:"Status"` // VideoPosted VideoSkippedUnplayable VideoSkippedAge VideoFailed VideoPending VideoRemoved
+	PublishedAt string `yaml:"PublishedAt"`
+
+	Attempts int    `yaml:"Attempts"`
+	Error    string `yaml:"Error,omitempty"`
+
+	TgMessageIds     []int64            `yaml:"TgMessageIds,flow"`          // in the channel TgChatId
+	TgDestMessageIds map[string][]int64 `yaml:"TgDestMessageIds,omitempty"` // in the channel TgDestinations by TgChatId
+
+	// TgMessagePhoto TgMessageAudio TgMessageVideo TgMessageDescription TgMessageNotice of the message ids
+	TgMessageKinds     []string            `yaml:"TgMessageKinds,flow,omitempty"`
+	TgDestMessageKinds map[string][]string `yaml:"TgDestMessageKinds,omitempty"`
+
+	TgPostedChatIds []string `yaml:"TgPostedChatIds,flow,omitempty"` // of the channel TgChatId and TgDestinations the video is completely posted to, skipped by the retries
+
+	// the posted video to edit the posts when it changes
+	YtTitle          string           `yaml:"YtTitle,omitempty"`
+	YtDescriptionSum string           `yaml:"YtDescriptionSum,omitempty"` // sha256 of the description
+	YtThumbUrl       string           `yaml:"YtThumbUrl,omitempty"`       // of the best thumbnail size
+	YtThumbSum       string           `yaml:"YtThumbSum,omitempty"`       // sha256 of the thumbnail
+	Duration         time.Duration    `yaml:"Duration,omitempty"`
+	TgParts          []TgTubeChanPart `yaml:"TgParts,omitempty"` // of the audio messages
+
+	// the captions of the photo, video and audio messages the TgRemovedNote is added to
+	TgPhotoCaption  string   `yaml:"TgPhotoCaption,omitempty"`
+	TgVideoCaption  string   `yaml:"TgVideoCaption,omitempty"`
+	TgAudioCaptions []string `yaml:"TgAudioCaptions,omitempty"`
+
+	Updated time.Time `yaml:"Updated"`
+}
+
+// TgTubeChanPart is an audio part or chapter posted as a message
+type TgTubeChanPart struct {
+	Start    time.Duration `yaml:"Start"`
+	Duration time.Duration `yaml:"Duration"`
+	Title    string        `yaml:"Title,omitempty"`
+}
+
+// TgTubeChanChannelState is the bot runtime state of a channel
+type TgTubeChanChannelState struct {
+	YtChannelId  string `yaml:"YtChannelId"`
+	YtPlaylistId string `yaml:"YtPlaylistId"`
+	YtLast       string `yaml:"YtLast"` // pagination cutoff, Videos decide what is posted
+
+	YtCheckLast time.Time `yaml:"YtCheckLast"`
+
+	TgEditCheckLast time.Time `yaml:"TgEditCheckLast"`
+
+	Seeded bool `yaml:"Seeded"` // Videos have the videos posted up to YtLast before the ledger, set by the first full listing
+
+	WebSubExpires   time.Time `yaml:"WebSubExpires"`     // lease expiry verified by the hub
+	WebSubRequested time.Time `yaml:"WebSubRequested"`   // last subscription request
+	WebSubVideos    []string  `yaml:"WebSubVideos,flow"` // video ids announced by the hub and not yet processed
+
+	Videos map[string]*TgTubeChanVideo `yaml:"Videos"`
+}
+
+// TgTubeChanState is the bot runtime state kept apart from the config so the config can stay read only
+type TgTubeChanState struct {
+	YssUrl    string `yaml:"-"`
+	StatePath string `yaml:"-"`
+
+	TgUpdateLog []int64 `yaml:"TgUpdateLog,flow"`
+
+	YtCheckLast time.Time `yaml:"YtCheckLast,omitempty"` // legacy, only seeds the channels states
+
+	Channels map[string]*TgTubeChanChannelState `yaml:"Channels"`
+}
+
 var (
 	Config TgTubeChanConfig
 
+	ConfigStorage ConfigStore
+
+	// ConfigSnap is a copy of Config made by every ConfigCheck for the readers not holding Mu
+	ConfigSnap atomic.Pointer[TgTubeChanConfig]
+
+	// Mu guards Config and State shared by the scheduler, the workers and the telegram updates handlers
+	Mu sync.Mutex
+
+	// StateDirty wakes up Writer to put the state
+	StateDirty = make(chan struct{}, 1)
+
+	// Writes are run one by one by Writer
+	Writes = make(chan TgTubeChanWrite)
+
+	// TgUpdatesMu makes the telegram updates handled one at a time
+	TgUpdatesMu sync.Mutex
+
+	// Jobs are handed by the scheduler to the idle workers
+	Jobs = make(chan *TgTubeChanJob)
+
+	// SchedulerWake is signalled by a worker done with a job
+	SchedulerWake = make(chan struct{}, 1)
+
+	// ChannelsQueued are keys of the channels queued or being checked, guarded by Mu,
+	// so a channel is never processed by two workers at once and its videos are posted in order
+	ChannelsQueued = make(map[string]bool)
+
+	// PushedRetry are the times the channels with failed pushed jobs are checked for the pushed videos again, guarded by Mu
+	PushedRetry = make(map[string]time.Time)
+
+	// Downloads and FfmpegRuns are semaphores limiting the workers downloads and ffmpeg runs
+	Downloads  chan struct{}
+	FfmpegRuns chan struct{}
+
+	State TgTubeChanState
+
+	StateStorage ConfigStore
+
 	Ctx context.Context
 
 	HttpClient = &http.Client{}
 
-	YtdlCl ytdl.Client
-	YtSvc  *youtube.Service
+	// YtAvatars are the decoded channels avatars by channel id guarded by YtAvatarsMu
+	YtAvatars   = make(map[string]YtAvatar)
+	YtAvatarsMu sync.Mutex
+
+	YtSvc    *youtube.Service
+	YtSvcKey string
 
 	ENUFF = errors.New("ENUFF")
 
-	TgBotUserId    int64
-	TgTitleCleanRe *regexp.Regexp
+	ErrConfigConflict = errors.New("config revision conflict")
+
+	TgBotUserId     int64
+	TgWebhookActive atomic.Bool
+
+	WebSubActive atomic.Bool
 
 	YtChannelReText = `youtube\.com/@([-_A-Za-z0-9]+)`
 	YtChannelRe     *regexp.Regexp
@@ -151,19 +451,6 @@ func init() {
 		os.Exit(1)
 	}
 
-	if v := os.Getenv("YssUrl"); v != "" {
-		Config.YssUrl = v
-	}
-	if Config.YssUrl == "" {
-		perr("ERROR YssUrl empty")
-		os.Exit(1)
-	}
-
-	if err := ConfigGet(); err != nil {
-		perr(F("ERROR ConfigGet %v", err))
-		os.Exit(1)
-	}
-
 	ytdl.VisitorIdMaxAge = 33 * time.Minute
 
 	/*
@@ -185,10 +472,28 @@ func init() {
 
 func ConfigGet() (err error) {
 
-	if err = Config.Get(); err != nil {
+	fresh := TgTubeChanConfig{YssUrl: Config.YssUrl, ConfigPath: Config.ConfigPath}
+	if err = fresh.Get(); err != nil {
+		return err
+	}
+
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	saved := Config
+	Config = fresh
+	if err = ConfigCheck(); err != nil {
+		Config = saved
 		return err
 	}
 
+	return nil
+
+}
+
+// ConfigCheck validates Config and fills in the defaults, must be called with Mu held
+func ConfigCheck() (err error) {
+
 	if Config.DEBUG {
 		perr("DEBUG <true>")
 		tg.DEBUG = true
@@ -207,7 +512,9 @@ func ConfigGet() (err error) {
 		return fmt.Errorf("TgApiUrl empty")
 	}
 
-	tg.ApiUrl = Config.TgApiUrl
+	if tg.ApiUrl != Config.TgApiUrl {
+		tg.ApiUrl = Config.TgApiUrl
+	}
 
 	if Config.TgToken == "" {
 		return fmt.Errorf("TgToken empty")
@@ -221,7 +528,9 @@ func ConfigGet() (err error) {
 		return fmt.Errorf("TgToken format must be [TgBotUserId:TgBotPassword]")
 	}
 
-	tg.ApiToken = Config.TgToken
+	if tg.ApiToken != Config.TgToken {
+		tg.ApiToken = Config.TgToken
+	}
 
 	if Config.TgChatId == "" {
 		return fmt.Errorf("TgChatId empty")
@@ -231,7 +540,40 @@ func ConfigGet() (err error) {
 		return fmt.Errorf("TgBossId empty")
 	}
 
-	perr(F("TgUpdateLog %v", Config.TgUpdateLog))
+	if Config.TgWebhookUrl != "" {
+		if Config.HttpListen == "" {
+			return fmt.Errorf("TgWebhookUrl set and HttpListen empty")
+		}
+		if Config.TgWebhookSecret == "" {
+			return fmt.Errorf("TgWebhookUrl set and TgWebhookSecret empty")
+		}
+		perr(F("TgWebhookUrl [%s]", Config.TgWebhookUrl))
+	}
+
+	if Config.WebSubUrl != "" {
+		if Config.HttpListen == "" {
+			return fmt.Errorf("WebSubUrl set and HttpListen empty")
+		}
+		if Config.WebSubSecret == "" {
+			return fmt.Errorf("WebSubUrl set and WebSubSecret empty")
+		}
+		if Config.WebSubLease <= 0 {
+			Config.WebSubLease = WebSubLeaseDefault
+		}
+		perr(F("WebSubUrl [%s] WebSubLease <%s>", Config.WebSubUrl, Config.WebSubLease))
+	}
+
+	if Config.Workers <= 0 {
+		Config.Workers = WorkersDefault
+	}
+	if Config.DownloadsMax <= 0 {
+		Config.DownloadsMax = Config.Workers
+	}
+	if Config.FfmpegRunsMax <= 0 {
+		Config.FfmpegRunsMax = Config.Workers
+	}
+	perr(F("Workers <%d> DownloadsMax <%d> FfmpegRunsMax <%d>", Config.Workers, Config.DownloadsMax, Config.FfmpegRunsMax))
+
 	if Config.TgUpdateLogMaxSize <= 0 {
 		Config.TgUpdateLogMaxSize = TgUpdateLogMaxSizeDefault
 	}
@@ -248,12 +590,59 @@ func ConfigGet() (err error) {
 	perr(F("DssUrl [%s]", Config.DssUrl))
 
 	for i, channel := range Config.Channels {
-		if channel.YtUsername == "" {
-			return fmt.Errorf("Channel <%d> YtUsername empty", i)
+		if len(channel.Sources) > 0 && channel.Name == "" {
+			return fmt.Errorf("Channel <%d> with Sources and Name empty", i)
+		}
+		switch channel.TgMode {
+		case "", TgModeAudio, TgModeVideo, TgModeBoth:
+		default:
+			return fmt.Errorf("Channel [%s] TgMode [%s] unknown", channel.Key(), channel.TgMode)
+		}
+		switch channel.TgAudioCodec {
+		case "", TgAudioCodecAac, TgAudioCodecCopy:
+		case TgAudioCodecOpus, TgAudioCodecMp3:
+			if Config.FfmpegPath == "" {
+				return fmt.Errorf("Channel [%s] TgAudioCodec [%s] and FfmpegPath empty", channel.Key(), channel.TgAudioCodec)
+			}
+		default:
+			return fmt.Errorf("Channel [%s] TgAudioCodec [%s] unknown", channel.Key(), channel.TgAudioCodec)
+		}
+		for _, text := range []string{channel.TgPhotoCaptionTemplate, channel.TgAudioCaptionTemplate, channel.TgDescriptionTemplate} {
+			if _, err := captionTemplate(text, ""); err != nil {
+				return fmt.Errorf("Channel [%s] %v", channel.Key(), err)
+			}
+		}
+		switch channel.TgRemovedMode {
+		case "", TgRemovedReport, TgRemovedNote, TgRemovedDelete:
+		default:
+			return fmt.Errorf("Channel [%s] TgRemovedMode [%s] unknown", channel.Key(), channel.TgRemovedMode)
+		}
+		switch channel.TgCoverMode {
+		case "", TgCoverCrop, TgCoverBlur, TgCoverAvatar:
+		default:
+			return fmt.Errorf("Channel [%s] TgCoverMode [%s] unknown", channel.Key(), channel.TgCoverMode)
+		}
+		if channel.TgLoudnessLufs != 0 {
+			if channel.TgLoudnessLufs < LoudnormLufsMin || channel.TgLoudnessLufs > LoudnormLufsMax {
+				return fmt.Errorf("Channel [%s] TgLoudnessLufs <%v> not in <%d..%d>", channel.Key(), channel.TgLoudnessLufs, LoudnormLufsMin, LoudnormLufsMax)
+			}
+			if Config.FfmpegPath == "" || channel.TgAudioCodec == TgAudioCodecCopy {
+				return fmt.Errorf("Channel [%s] TgLoudnessLufs with FfmpegPath empty or TgAudioCodec copy", channel.Key())
+			}
 		}
-		if channel.TgTitleCleanRe != "" {
-			if _, err := regexp.Compile(channel.TgTitleCleanRe); err != nil {
-				return fmt.Errorf("Channel [%s] TgTitleCleanRe [%s] %v", channel.YtUsername, channel.TgTitleCleanRe, err)
+		for _, dest := range channel.TgDestinations {
+			if dest.TgChatId == "" || dest.TgChatId == channel.TgChatId {
+				return fmt.Errorf("Channel [%s] TgDestinations TgChatId [%s] empty or same as the channel TgChatId", channel.Key(), dest.TgChatId)
+			}
+		}
+		for _, source := range channel.SourcesList() {
+			if source.YtUsername == "" && source.YtPlaylistId == "" {
+				return fmt.Errorf("Channel <%d> [%s] YtUsername and YtPlaylistId empty", i, source.Key())
+			}
+			if source.TgTitleCleanRe != "" {
+				if _, err := regexp.Compile(source.TgTitleCleanRe); err != nil {
+					return fmt.Errorf("Channel [%s] TgTitleCleanRe [%s] %v", source.Key(), source.TgTitleCleanRe, err)
+				}
 			}
 		}
 	}
@@ -262,9 +651,21 @@ func ConfigGet() (err error) {
 		return fmt.Errorf("YtKey empty")
 	}
 
-	if YtSvc, err = youtube.NewService(Ctx, youtubeoption.WithAPIKey(Config.YtKey)); err != nil {
-		return fmt.Errorf("youtube NewService %v", err)
+	if YtSvc == nil || YtSvcKey != Config.YtKey {
+		if YtSvc, err = youtube.NewService(Ctx, youtubeoption.WithAPIKey(Config.YtKey)); err != nil {
+			return fmt.Errorf("youtube NewService %v", err)
+		}
+		YtSvcKey = Config.YtKey
+	}
+
+	if _, err := time.LoadLocation(Config.TgTimezone); err != nil {
+		return fmt.Errorf("TgTimezone [%s] %v", Config.TgTimezone, err)
+	}
+
+	if Config.TgFileSizeMaxMb <= 0 {
+		Config.TgFileSizeMaxMb = TgFileSizeMaxMbDefault
 	}
+	perr(F("TgFileSizeMaxMb <%d>", Config.TgFileSizeMaxMb))
 
 	if Config.YtMaxResults == 0 {
 		Config.YtMaxResults = 50
@@ -282,627 +683,3985 @@ func ConfigGet() (err error) {
 		}
 	}
 	perr(F("YtCheckInterval <%s>", Config.YtCheckInterval))
-	perr(F("YtCheckLast <%s>", Config.YtCheckLast))
+
+	if Config.YtLookback == 0 {
+		Config.YtLookback = YtLookbackDefault
+	}
+	perr(F("YtLookback <%s>", Config.YtLookback))
+	if Config.YtRetryMax <= 0 {
+		Config.YtRetryMax = YtRetryMaxDefault
+	}
+	perr(F("YtRetryMax <%d>", Config.YtRetryMax))
+	if Config.YtLedgerKeep == 0 {
+		Config.YtLedgerKeep = YtLedgerKeepDefault
+	}
+	if Config.YtLedgerKeep < Config.YtLookback {
+		return fmt.Errorf("YtLedgerKeep <%s> less than YtLookback <%s>", Config.YtLedgerKeep, Config.YtLookback)
+	}
+	perr(F("YtLedgerKeep <%s>", Config.YtLedgerKeep))
+
+	if Config.TgEditWindow > Config.YtLedgerKeep || Config.TgRemovedWindow > Config.YtLedgerKeep {
+		return fmt.Errorf("TgEditWindow <%s> or TgRemovedWindow <%s> more than YtLedgerKeep <%s>", Config.TgEditWindow, Config.TgRemovedWindow, Config.YtLedgerKeep)
+	}
+	if Config.TgEditInterval <= 0 {
+		Config.TgEditInterval = TgEditIntervalDefault
+	}
+	perr(F("TgEditWindow <%s> TgRemovedWindow <%s> TgEditInterval <%s>", Config.TgEditWindow, Config.TgRemovedWindow, Config.TgEditInterval))
 
 	perr(F("FfmpegPath [%s]", Config.FfmpegPath))
 	perr(F("FfmpegGlobalOptions %s", AtonListStrings(Config.FfmpegGlobalOptions)))
 
+	for _, channel := range Config.Channels {
+		for _, source := range channel.SourcesList() {
+			switch source.YtSource {
+			case "", YtSourceApi, YtSourceFeed:
+			default:
+				return fmt.Errorf("%s YtSource [%s] unknown", source.Key(), source.YtSource)
+			}
+		}
+	}
+
 	perr("DEBUG Channels (")
 	for _, channel := range Config.Channels {
-		perr(F("DEBUG { @Suspend <%d> @YtUsername [%s] @YtLast <%s> }", BTOI[channel.Suspend], channel.YtUsername, channel.YtLast))
+		perr(F("DEBUG { @Suspend <%d> @YtUsername [%s] @YtPlaylistId [%s] }", BTOI[channel.Suspend], channel.YtUsername, channel.YtPlaylistId))
 	}
 	perr("DEBUG )")
 
+	snap := Config
+	snap.Channels = slices.Clone(Config.Channels)
+	ConfigSnap.Store(&snap)
+
 	return nil
 
 }
 
 func main() {
+	// the config is loaded here and not by init for the tests to run without one
+	if v := os.Getenv("YssUrl"); v != "" {
+		Config.YssUrl = v
+	}
+	if v := os.Getenv("ConfigPath"); v != "" {
+		Config.ConfigPath = v
+	}
+	if Config.YssUrl != "" {
+		ConfigStorage = &YssConfigStore{Url: Config.YssUrl}
+	} else if Config.ConfigPath != "" {
+		ConfigStorage = &FileConfigStore{Path: Config.ConfigPath}
+	} else {
+		perr("ERROR YssUrl and ConfigPath empty")
+		os.Exit(1)
+	}
+
+	if err := ConfigGet(); err != nil {
+		perr(F("ERROR ConfigGet %v", err))
+		os.Exit(1)
+	}
+
+	// state goes next to the config unless StateYssUrl or StatePath are set
+	if v := os.Getenv("StateYssUrl"); v != "" {
+		State.YssUrl = v
+	}
+	if v := os.Getenv("StatePath"); v != "" {
+		State.StatePath = v
+	}
+	if State.YssUrl == "" && State.StatePath == "" {
+		if Config.YssUrl != "" {
+			State.YssUrl = Config.YssUrl + ".state"
+		} else {
+			ext := filepath.Ext(Config.ConfigPath)
+			State.StatePath = strings.TrimSuffix(Config.ConfigPath, ext) + ".state" + ext
+		}
+	}
+	if State.YssUrl != "" {
+		StateStorage = &YssConfigStore{Url: State.YssUrl, Overwrite: true}
+	} else {
+		StateStorage = &FileConfigStore{Path: State.StatePath, Overwrite: true}
+	}
+
+	if err := State.Get(); err != nil {
+		perr(F("ERROR State.Get %v", err))
+		os.Exit(1)
+	}
+	if len(State.TgUpdateLog) == 0 && len(Config.TgUpdateLog) > 0 {
+		// the updates handled before the state was kept apart
+		State.TgUpdateLog = slices.Clone(Config.TgUpdateLog)
+		perr(F("TgUpdateLog %v from the config", State.TgUpdateLog))
+	}
+
 	sigterm := make(chan os.Signal, 1)
 	signal.Notify(sigterm, syscall.SIGTERM)
 	go func(sigterm chan os.Signal) {
 		<-sigterm
 		tglog(F("%s sigterm", os.Args[0]))
+		if err := Write(StatePut); err != nil {
+			perr(F("ERROR StatePut %v", err))
+		}
 		os.Exit(1)
 	}(sigterm)
 
+	go Writer()
+
+	var httperr error
+	if Config.TgWebhookUrl != "" || Config.WebSubUrl != "" {
+		if httperr = HttpStart(HttpStopped); httperr != nil {
+			tglog(F("ERROR HttpStart %v", httperr))
+		}
+	}
+
+	if Config.TgWebhookUrl != "" && httperr == nil {
+		if err := TgWebhookStart(); err != nil {
+			tglog(F("ERROR TgWebhookStart %v, falling back to getUpdates", err))
+		}
+	} else if err := TgApiPost("deleteWebhook", struct{}{}, nil); err != nil {
+		perr(F("ERROR deleteWebhook %v", err))
+	}
+
+	if Config.WebSubUrl != "" && httperr == nil {
+		if err := WebSubStart(); err != nil {
+			tglog(F("ERROR WebSubStart %v", err))
+		}
+	}
+
+	go TgUpdatesLoop()
+
+	Downloads = make(chan struct{}, Config.DownloadsMax)
+	FfmpegRuns = make(chan struct{}, Config.FfmpegRunsMax)
+	for i := 0; i < Config.Workers; i++ {
+		go Worker()
+	}
+
+	Scheduler()
+}
+
+// Scheduler gets the config every Interval and hands the due channels to the workers
+func Scheduler() {
 	for {
-		err := ConfigGet()
-		if err != nil {
+		if err := Write(ConfigGet); err != nil {
 			perr(F("ERROR ConfigGet %v", err))
 			os.Exit(1)
 		}
 
+		Mu.Lock()
 		ticker := time.NewTicker(Config.Interval)
+		Mu.Unlock()
 
-		err = TgGetUpdates()
-		if err != nil {
-			tglog(F("ERROR TgGetUpdates %v", err))
+		if WebSubActive.Load() {
+			WebSubRenew()
 		}
 
-		if time.Since(Config.YtCheckLast) > Config.YtCheckInterval {
+		Schedule()
 
-			channels := Config.Channels
-			rand.Shuffle(len(channels), func(i, j int) {
-				channels[i], channels[j] = channels[j], channels[i]
-			})
+	wait:
+		for {
+			select {
+			case <-SchedulerWake:
+				Schedule()
+			case <-ticker.C:
+				break wait
+			}
+		}
+		ticker.Stop()
+	}
+}
 
-			for jchannel, _ := range channels {
-				channel := &channels[jchannel]
-				if channel.Suspend {
-					perr(F("DEBUG %s suspended", channel.YtUsername))
-					continue
-				} else {
-					perr(F("DEBUG %s", channel.YtUsername))
-				}
-				err = processYtChannel(channel)
-				if err != nil {
-					tglog(F("ERROR %s %v", channel.YtUsername, err))
-				}
+// Schedule hands the channels past their YtCheckInterval to the idle workers, the most overdue first
+func Schedule() {
+	Mu.Lock()
+	defer Mu.Unlock()
 
-				Config.YtCheckLast = time.Now()
-				if err := Config.Put(); err != nil {
-					perr(F("ERROR Config.Put %v", err))
+	type due struct {
+		channel TgTubeChanChannel
+		overdue time.Duration
+		pushed  map[string][]string
+	}
+
+	tnow := time.Now()
+	var dues []due
+	for _, channel := range Config.Channels {
+		if channel.Suspend || ChannelsQueued[channel.Key()] {
+			continue
+		}
+		chstate := State.Channel(&channel)
+		overdue := tnow.Sub(chstate.YtCheckLast.Add(channel.CheckInterval(&Config)))
+		var pushed map[string][]string
+		for _, source := range channel.SourcesList() {
+			if srcstate := State.Channel(&source); len(srcstate.WebSubVideos) > 0 {
+				if pushed == nil {
+					pushed = make(map[string][]string)
 				}
+				pushed[source.Key()] = slices.Clone(srcstate.WebSubVideos)
 			}
-
 		}
+		if tnow.Before(PushedRetry[channel.Key()]) {
+			pushed = nil
+		}
+		if overdue < 0 && len(pushed) == 0 {
+			continue
+		}
+		dues = append(dues, due{channel: channel, overdue: overdue, pushed: pushed})
+	}
 
-		//perr("DEBUG sleeping")
-		<-ticker.C
+	// the channels with videos announced by the hub go first
+	sort.SliceStable(dues, func(i, j int) bool {
+		if (len(dues[i].pushed) > 0) != (len(dues[j].pushed) > 0) {
+			return len(dues[i].pushed) > 0
+		}
+		return dues[i].overdue > dues[j].overdue
+	})
+
+	for _, d := range dues {
+		job := NewJob(d.channel)
+		job.Pushed = d.pushed
+		select {
+		case Jobs <- job:
+			perr(F("DEBUG %s overdue <%v> pushed %v", d.channel.Key(), d.overdue.Truncate(time.Second), d.pushed))
+			ChannelsQueued[d.channel.Key()] = true
+		default:
+			// no idle workers
+			return
+		}
 	}
+}
 
-	return
+// Mode is the channel TgMode, TgModeAudio when it is not set
+func (channel *TgTubeChanChannel) Mode() string {
+	if channel.TgMode == "" {
+		return TgModeAudio
+	}
+	return channel.TgMode
 }
 
-func TgGetUpdates() (err error) {
+// AudioCodec is the channel TgAudioCodec, TgAudioCodecAac when it is not set
+func (channel *TgTubeChanChannel) AudioCodec() string {
+	if channel.TgAudioCodec == "" {
+		return TgAudioCodecAac
+	}
+	return channel.TgAudioCodec
+}
 
-	var updatesoffset int64
-	if len(Config.TgUpdateLog) > 0 {
-		updatesoffset = Config.TgUpdateLog[len(Config.TgUpdateLog)-1] + 1
+// RemovedMode is the channel TgRemovedMode, TgRemovedReport when it is not set
+func (channel *TgTubeChanChannel) RemovedMode() string {
+	if channel.TgRemovedMode == "" {
+		return TgRemovedReport
 	}
+	return channel.TgRemovedMode
+}
 
-	var uu []tg.Update
-	uu, _, err = tg.GetUpdates(updatesoffset)
-	if err != nil {
-		return fmt.Errorf("tg.GetUpdates %v", err)
+// DestinationsList returns the channel TgChatId with its options followed by TgDestinations
+func (channel *TgTubeChanChannel) DestinationsList() []TgTubeChanDestination {
+	return append([]TgTubeChanDestination{{
+		TgChatId:          channel.TgChatId,
+		TgSkipPhoto:       channel.TgSkipPhoto,
+		TgSkipDescription: channel.TgSkipDescription,
+	}}, channel.TgDestinations...)
+}
+
+// Sources returns the sources of all the channels
+func (config *TgTubeChanConfig) Sources() (sources []TgTubeChanChannel) {
+	for _, channel := range config.Channels {
+		sources = append(sources, channel.SourcesList()...)
 	}
+	return sources
+}
 
-	for _, u := range uu {
-		perr(F("Update %s", strings.ReplaceAll(tg.F("%+v", u), NL, "<NL>")))
-		if slices.Contains(Config.TgUpdateLog, u.UpdateId) {
-			perr(F("WARNING this telegram update id <%d> was already processed, skipping", u.UpdateId))
-			continue
+// SourcesList returns the channel Sources as channels with the fields not set taken from the channel
+// and keyed by Name/YtUsername, or the channel itself when it has no Sources
+func (channel *TgTubeChanChannel) SourcesList() []TgTubeChanChannel {
+	if len(channel.Sources) == 0 {
+		return []TgTubeChanChannel{*channel}
+	}
+	var sources []TgTubeChanChannel
+	for _, source := range channel.Sources {
+		s := *channel
+		s.Sources = nil
+		s.Name = ""
+		s.YtUsername, s.YtChannelId, s.YtPlaylistId, s.YtLast = source.YtUsername, source.YtChannelId, source.YtPlaylistId, source.YtLast
+		// a source has its own ledger apart from the channel with the same youtube handle
+		s.Name = channel.Key() + "/" + s.Key()
+		if source.YtSource != "" {
+			s.YtSource = source.YtSource
 		}
-		Config.TgUpdateLog = append(Config.TgUpdateLog, u.UpdateId)
-		if len(Config.TgUpdateLog) > Config.TgUpdateLogMaxSize {
-			Config.TgUpdateLog = Config.TgUpdateLog[len(Config.TgUpdateLog)-Config.TgUpdateLogMaxSize:]
+		if source.TgPerformer != "" {
+			s.TgPerformer = source.TgPerformer
 		}
-		if err := Config.Put(); err != nil {
-			return fmt.Errorf("Config.Put %v", err)
+		if source.TgTitleCleanRe != "" {
+			s.TgTitleCleanRe = source.TgTitleCleanRe
 		}
+		s.TgTitleUnquote = s.TgTitleUnquote || source.TgTitleUnquote
+		sources = append(sources, s)
+	}
+	return sources
+}
 
-		if u.MyChatMember.Date != 0 {
-			mcm := u.MyChatMember
-			tglog(F("@MyChatMember %#v", mcm))
+// CheckInterval is the channel YtCheckInterval or the config one when it is not set
+func (channel *TgTubeChanChannel) CheckInterval(config *TgTubeChanConfig) time.Duration {
+	if channel.YtCheckInterval > 0 {
+		return channel.YtCheckInterval
+	}
+	return config.YtCheckInterval
+}
 
-			if tg.F("%d", mcm.From.Id) != Config.TgBossId {
-				continue
-			}
-			if mcm.Chat.Type != "channel" {
-				continue
-			}
-			if mcm.NewChatMember.User.Id != TgBotUserId {
-				continue
-			}
+// TgTubeChanJob is a channel check with its own copies of the channel and the config
+type TgTubeChanJob struct {
+	Channel TgTubeChanChannel
+	Config  TgTubeChanConfig
 
-			if mcm.NewChatMember.Status == "administrator" {
+	YtSvc  *youtube.Service
+	YtdlCl ytdl.Client
 
-				chatfullinfo, err := tg.GetChat(mcm.Chat.Id)
-				if err != nil {
-					return fmt.Errorf("tg.GetChat <%d> %v", mcm.Chat.Id, err)
-				}
-				perr(F("DEBUG chatfullinfo.Description [%s]", chatfullinfo.Description))
+	// Pushed are the video ids announced by the hub by the source keys, the channel is not polled then
+	Pushed map[string][]string
+}
 
-				// https://pkg.go.dev/regexp#Regexp.FindStringSubmatch
-				ssm := YtChannelRe.FindStringSubmatch(chatfullinfo.Description)
-				perr(F("DEBUG YtChannelRe.FindStringSubmatch chatfullinfo.Description %#v", ssm))
+// NewJob makes a check job of the channel, must be called with Mu held
+func NewJob(channel TgTubeChanChannel) *TgTubeChanJob {
+	job := &TgTubeChanJob{
+		Channel: channel,
+		Config:  Config,
+
+		YtSvc: YtSvc,
+		YtdlCl: ytdl.Client{
+			HTTPClient: &http.Client{
+				Transport: &UserAgentTransport{
+					http.DefaultTransport,
+					Config.YtUserAgent,
+				},
+			},
+		},
+	}
+	job.Config.Channels = nil
+	return job
+}
 
-				if len(ssm) != 2 {
-					continue
-				}
+// Worker runs the queued channels checks
+func Worker() {
+	for job := range Jobs {
+		perr(F("DEBUG %s", job.Channel.Key()))
+		err := processYtChannel(job)
+		if err != nil {
+			tglog(F("ERROR %s %v", job.Channel.Key(), err))
+		}
 
-				newchannel := TgTubeChanChannel{
-					YtUsername: ssm[1],
-					TgChatId:   tg.F("%d", mcm.Chat.Id),
-					//TgPerformer:       mcm.Chat.Title,
-					TgSkipPhoto:       false,
-					TgSkipDescription: false,
-				}
-				tglog(F("DEBUG new channel %#v", newchannel))
+		Mu.Lock()
+		delete(ChannelsQueued, job.Channel.Key())
+		if len(job.Pushed) == 0 {
+			State.Channel(&job.Channel).YtCheckLast = time.Now()
+		} else if err != nil {
+			// the pushed videos are kept and tried again after Interval
+			PushedRetry[job.Channel.Key()] = time.Now().Add(Config.Interval)
+		} else {
+			delete(PushedRetry, job.Channel.Key())
+			for key, videoids := range job.Pushed {
+				// the videos pushed while the job was running stay
+				srcstate := State.Channels[key]
+				srcstate.WebSubVideos = slices.DeleteFunc(srcstate.WebSubVideos, func(videoid string) bool {
+					return slices.Contains(videoids, videoid)
+				})
+			}
+		}
+		StateSave()
+		Mu.Unlock()
 
-				addchannel := true
-				for i := range Config.Channels {
-					if Config.Channels[i].YtUsername == newchannel.YtUsername {
-						Config.Channels[i].Suspend = false
-						perr(F("channel @YtUsername [%s] @Suspend <%t>", Config.Channels[i].YtUsername, Config.Channels[i].Suspend))
-						addchannel = false
-					}
-				}
-				if addchannel {
-					tgmsg := tg.Bold(strings.ToUpper(mcm.Chat.Title)) + NL + NL + tg.Esc(chatfullinfo.Description)
-					if _, tgerr := tg.SendMessage(tg.SendMessageRequest{
-						ChatId: fmt.Sprintf("%d", mcm.Chat.Id),
-						Text:   tgmsg,
-					}); tgerr != nil {
-						perr(F("tg.SendMessage %v", tgerr))
-						return tgerr
-					}
-					Config.Channels = append(Config.Channels, newchannel)
+		SchedulerPoke()
+	}
+}
+
+// SchedulerPoke makes the scheduler hand the due channels to the workers without waiting for Interval
+func SchedulerPoke() {
+	select {
+	case SchedulerWake <- struct{}{}:
+	default:
+	}
+}
+
+// TgUpdatesLoop long polls the telegram updates while the webhook is not active
+func TgUpdatesLoop() {
+	for {
+		if !TgWebhookActive.Load() {
+			err := TgGetUpdates()
+			if err == nil {
+				continue
+			}
+			tglog(F("ERROR TgGetUpdates %v", err))
+		}
+		time.Sleep(ConfigSnap.Load().Interval)
+	}
+}
+
+func TgGetUpdates() (err error) {
+
+	var updatesoffset int64
+	Mu.Lock()
+	if len(State.TgUpdateLog) > 0 {
+		updatesoffset = State.TgUpdateLog[len(State.TgUpdateLog)-1] + 1
+	}
+	Mu.Unlock()
+
+	var uu []TgUpdate
+	uu, err = TgGetUpdatesOffset(updatesoffset)
+	if err != nil {
+		return fmt.Errorf("TgGetUpdatesOffset %v", err)
+	}
+
+	for _, u := range uu {
+		if err := TgUpdateProcess(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// TgUpdateProcess handles an update received either by getUpdates or by the webhook
+func TgUpdateProcess(u TgUpdate) (err error) {
+	TgUpdatesMu.Lock()
+	defer TgUpdatesMu.Unlock()
+
+	perr(F("Update %s", strings.ReplaceAll(tg.F("%+v", u), NL, "<NL>")))
+
+	Mu.Lock()
+	if slices.Contains(State.TgUpdateLog, u.UpdateId) {
+		Mu.Unlock()
+		perr(F("WARNING this telegram update id <%d> was already processed, skipping", u.UpdateId))
+		return nil
+	}
+	State.TgUpdateLog = append(State.TgUpdateLog, u.UpdateId)
+	if len(State.TgUpdateLog) > Config.TgUpdateLogMaxSize {
+		State.TgUpdateLog = State.TgUpdateLog[len(State.TgUpdateLog)-Config.TgUpdateLogMaxSize:]
+	}
+	StateSave()
+	bossid, botuserid := Config.TgBossId, TgBotUserId
+	Mu.Unlock()
+
+	if u.Message.Date != 0 && strings.HasPrefix(u.Message.Text, "/") {
+		if err := TgCommand(u.Message); err != nil {
+			perr(F("ERROR TgCommand %v", err))
+		}
+		return nil
+	}
+
+	if u.Message.Date != 0 && u.Message.Text != "" {
+		if err := TgSettingsEditValue(u.Message); err != nil {
+			perr(F("ERROR TgSettingsEditValue %v", err))
+		}
+		return nil
+	}
+
+	if u.CallbackQuery.Id != "" {
+		if err := TgSettingsCallback(u.CallbackQuery); err != nil {
+			perr(F("ERROR TgSettingsCallback %v", err))
+		}
+		return nil
+	}
+
+	if u.MyChatMember.Date != 0 {
+		mcm := u.MyChatMember
+		tglog(F("@MyChatMember %#v", mcm))
+
+		if tg.F("%d", mcm.From.Id) != bossid {
+			return nil
+		}
+		if mcm.Chat.Type != "channel" {
+			return nil
+		}
+		if mcm.NewChatMember.User.Id != botuserid {
+			return nil
+		}
+
+		if mcm.NewChatMember.Status == "administrator" {
+
+			chatfullinfo, err := tg.GetChat(mcm.Chat.Id)
+			if err != nil {
+				return fmt.Errorf("tg.GetChat <%d> %v", mcm.Chat.Id, err)
+			}
+			perr(F("DEBUG chatfullinfo.Description [%s]", chatfullinfo.Description))
+
+			// https://pkg.go.dev/regexp#Regexp.FindStringSubmatch
+			ssm := YtChannelRe.FindStringSubmatch(chatfullinfo.Description)
+			perr(F("DEBUG YtChannelRe.FindStringSubmatch chatfullinfo.Description %#v", ssm))
+
+			if len(ssm) != 2 {
+				return nil
+			}
+
+			newchannel := TgTubeChanChannel{
+				YtUsername: ssm[1],
+				TgChatId:   tg.F("%d", mcm.Chat.Id),
+				//TgPerformer:       mcm.Chat.Title,
+				TgSkipPhoto:       false,
+				TgSkipDescription: false,
+			}
+			tglog(F("DEBUG new channel %#v", newchannel))
+
+			var addchannel bool
+			if err := ConfigEdit(func(config *TgTubeChanConfig) error {
+				addchannel = true
+				for i := range config.Channels {
+					if config.Channels[i].YtUsername == newchannel.YtUsername {
+						config.Channels[i].Suspend = false
+						perr(F("channel @YtUsername [%s] @Suspend <%t>", config.Channels[i].YtUsername, config.Channels[i].Suspend))
+						addchannel = false
+					}
+				}
+				if addchannel {
+					config.Channels = append(config.Channels, newchannel)
+				}
+				return nil
+			}); err != nil {
+				return fmt.Errorf("ConfigEdit %v", err)
+			}
+			if addchannel {
+				tgmsg := tg.Bold(strings.ToUpper(mcm.Chat.Title)) + NL + NL + tg.Esc(chatfullinfo.Description)
+				if _, tgerr := tg.SendMessage(tg.SendMessageRequest{
+					ChatId: fmt.Sprintf("%d", mcm.Chat.Id),
+					Text:   tgmsg,
+				}); tgerr != nil {
+					perr(F("tg.SendMessage %v", tgerr))
+					return tgerr
+				}
+			}
+
+			if chatfullinfo.Photo.BigFileId == "" {
+				tglog(F("gonna set photo for chat [%s]", mcm.Chat.Title))
+			}
+
+		} else if mcm.NewChatMember.Status == "left" {
+
+			if err := ConfigEdit(func(config *TgTubeChanConfig) error {
+				for i := range config.Channels {
+					if config.Channels[i].TgChatId == tg.F("%d", mcm.Chat.Id) {
+						config.Channels[i].Suspend = true
+						perr(F("channel @YtUsername [%s] @Suspend <%t>", config.Channels[i].YtUsername, config.Channels[i].Suspend))
+					}
+				}
+				return nil
+			}); err != nil {
+				return fmt.Errorf("ConfigEdit %v", err)
+			}
+
+		}
+
+	}
+
+	return nil
+}
+
+// HttpMux serves the webhooks on Config.HttpListen
+var HttpMux = http.NewServeMux()
+
+// HttpStart listens on Config.HttpListen and serves HttpMux,
+// onerror is called if the server stops
+func HttpStart(onerror func(err error)) error {
+	ln, err := net.Listen("tcp", Config.HttpListen)
+	if err != nil {
+		return fmt.Errorf("net.Listen [%s] %v", Config.HttpListen, err)
+	}
+	perr(F("listening on [%s]", Config.HttpListen))
+	go func() {
+		err := http.Serve(ln, HttpMux)
+		onerror(err)
+	}()
+	return nil
+}
+
+type TgSetWebhookRequest struct {
+	// https://core.telegram.org/bots/api#setwebhook
+	Url         string `json:"url"`
+	SecretToken string `json:"secret_token"`
+}
+
+// HttpStopped falls back to getUpdates and polling when the http server stops
+func HttpStopped(err error) {
+	tglog(F("ERROR http.Serve %v", err))
+	WebSubActive.Store(false)
+	if TgWebhookActive.Swap(false) {
+		tglog("falling back to getUpdates")
+		if err := TgApiPost("deleteWebhook", struct{}{}, nil); err != nil {
+			perr(F("ERROR deleteWebhook %v", err))
+		}
+	}
+}
+
+// TgWebhookStart serves the webhook and registers it with setWebhook,
+// getUpdates is used again if the server stops
+func TgWebhookStart() error {
+	webhookurl, err := url.Parse(Config.TgWebhookUrl)
+	if err != nil {
+		return fmt.Errorf("url.Parse TgWebhookUrl [%s] %v", Config.TgWebhookUrl, err)
+	}
+	path := webhookurl.Path
+	if path == "" {
+		path = "/"
+	}
+	HttpMux.HandleFunc(path, TgWebhookHandler)
+
+	if err := TgApiPost("setWebhook", TgSetWebhookRequest{
+		Url:         Config.TgWebhookUrl,
+		SecretToken: Config.TgWebhookSecret,
+	}, nil); err != nil {
+		return err
+	}
+
+	TgWebhookActive.Store(true)
+	return nil
+}
+
+// TgWebhookHandler handles an update right away without waiting for the channels loop
+func TgWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	Mu.Lock()
+	webhooksecret := Config.TgWebhookSecret
+	Mu.Unlock()
+
+	secret := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(webhooksecret)) != 1 {
+		perr(F("WARNING webhook request from [%s] with invalid secret token", r.RemoteAddr))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var u TgUpdate
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// errors are not reported to telegram so it does not redeliver the update again and again
+	if err := TgUpdateProcess(u); err != nil {
+		tglog(F("ERROR TgUpdateProcess %v", err))
+	}
+}
+
+// TgIsAdmin tells if the telegram user is allowed to manage the bot
+func TgIsAdmin(userid int64) bool {
+	Mu.Lock()
+	defer Mu.Unlock()
+	id := tg.F("%d", userid)
+	return id == Config.TgBossId || slices.Contains(Config.TgAdminIds, id)
+}
+
+// TgCommand runs a command sent to the bot in a private chat and replies with the result
+func TgCommand(m tg.Message) (err error) {
+	if m.Chat.Type != "private" {
+		return nil
+	}
+	if !TgIsAdmin(m.From.Id) {
+		perr(F("WARNING command from not admin user id <%d> @%s", m.From.Id, m.From.Username))
+		return nil
+	}
+
+	args := strings.Fields(m.Text)
+	// /list@botname in chats with several bots
+	cmd, _, _ := strings.Cut(args[0], "@")
+	args = args[1:]
+	perr(F("command %s %s", cmd, AtonListStrings(args)))
+
+	var reply string
+	switch cmd {
+	case "/list":
+		reply = TgCommandList()
+	case "/status":
+		reply = TgCommandStatus()
+	case "/add":
+		reply, err = TgCommandAdd(args)
+	case "/suspend", "/resume", "/remove":
+		reply, err = TgCommandChannel(cmd, args)
+	case "/set":
+		reply, err = TgCommandSet(args)
+	case "/settings":
+		if len(args) != 1 {
+			reply = "usage: /settings @YtUsername"
+			break
+		}
+		return TgSettingsSend(m.Chat.Id, args[0])
+	default:
+		reply = "commands:" + NL +
+			"/list" + NL +
+			"/status" + NL +
+			"/add @YtUsername|YtPlaylistId TgChatId" + NL +
+			"/suspend @YtUsername" + NL +
+			"/resume @YtUsername" + NL +
+			"/remove @YtUsername" + NL +
+			"/set @YtUsername Field value" + NL +
+			"/settings @YtUsername"
+	}
+	if err != nil {
+		reply = F("ERROR %s %v", cmd, err)
+	}
+
+	if _, err := tg.SendMessage(tg.SendMessageRequest{
+		ChatId: tg.F("%d", m.Chat.Id),
+		Text:   tg.Esc(reply),
+
+		LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
+	}); err != nil {
+		return fmt.Errorf("tg.SendMessage %v", err)
+	}
+
+	return nil
+}
+
+// ChannelIndex finds the channel by @YtUsername, YtPlaylistId of a playlist channel or TgChatId, returns -1 if there is none
+func (config *TgTubeChanConfig) ChannelIndex(key string) int {
+	for i, channel := range config.Channels {
+		if channel.Key() == strings.TrimPrefix(key, "@") || channel.TgChatId == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func TgCommandList() string {
+	Mu.Lock()
+	defer Mu.Unlock()
+	if len(Config.Channels) == 0 {
+		return "no channels"
+	}
+	var ll []string
+	for _, channel := range Config.Channels {
+		l := F("@%s %s", channel.Key(), channel.TgChatId)
+		if channel.TgPerformer != "" {
+			l += F(" [%s]", channel.TgPerformer)
+		}
+		if channel.Suspend {
+			l += " suspended"
+		}
+		ll = append(ll, l)
+	}
+	return strings.Join(ll, NL)
+}
+
+func TgCommandStatus() string {
+	Mu.Lock()
+	defer Mu.Unlock()
+	var ll []string
+	for _, channel := range Config.Channels {
+		l := "@" + channel.Key()
+		if channel.Suspend {
+			l += " suspended"
+		}
+		chstate, ok := State.Channels[channel.Key()]
+		if !ok {
+			ll = append(ll, l+" never checked")
+			continue
+		}
+		l += F(" checked %s ago every %s", time.Since(chstate.YtCheckLast).Truncate(time.Second), channel.CheckInterval(&Config))
+		l += F(" YtLast %s", chstate.YtLast)
+		statuses := make(map[string]int)
+		for _, video := range chstate.Videos {
+			statuses[video.Status]++
+		}
+		for _, status := range []string{VideoPosted, VideoSkippedUnplayable, VideoSkippedAge, VideoFailed, VideoPending, VideoRemoved} {
+			if statuses[status] > 0 {
+				l += F(" %s:%d", status, statuses[status])
+			}
+		}
+		ll = append(ll, l)
+	}
+	return strings.Join(ll, NL)
+}
+
+func TgCommandAdd(args []string) (reply string, err error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("usage: /add @YtUsername|YtPlaylistId TgChatId")
+	}
+	newchannel := TgTubeChanChannel{TgChatId: args[1]}
+	if strings.HasPrefix(args[0], "@") {
+		newchannel.YtUsername = strings.TrimPrefix(args[0], "@")
+	} else {
+		newchannel.YtPlaylistId = args[0]
+	}
+	if err := ConfigEdit(func(config *TgTubeChanConfig) error {
+		if config.ChannelIndex(newchannel.Key()) >= 0 {
+			return fmt.Errorf("channel @%s exists", newchannel.Key())
+		}
+		config.Channels = append(config.Channels, newchannel)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return F("added @%s %s", newchannel.Key(), newchannel.TgChatId), nil
+}
+
+func TgCommandChannel(cmd string, args []string) (reply string, err error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: %s @YtUsername", cmd)
+	}
+	if err := ConfigEdit(func(config *TgTubeChanConfig) error {
+		i := config.ChannelIndex(args[0])
+		if i < 0 {
+			return fmt.Errorf("no channel %s", args[0])
+		}
+		switch cmd {
+		case "/suspend":
+			config.Channels[i].Suspend = true
+		case "/resume":
+			config.Channels[i].Suspend = false
+		case "/remove":
+			config.Channels = slices.Delete(config.Channels, i, i+1)
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return F("%s %s done", cmd, args[0]), nil
+}
+
+// TgCommandSet sets a channel field by its yaml name, the value is parsed as yaml unless the field is a string
+func TgCommandSet(args []string) (reply string, err error) {
+	if len(args) < 2 {
+		return "", fmt.Errorf("usage: /set @YtUsername Field value")
+	}
+	field, value := args[1], strings.Join(args[2:], SP)
+	if err := ConfigEdit(func(config *TgTubeChanConfig) error {
+		i := config.ChannelIndex(args[0])
+		if i < 0 {
+			return fmt.Errorf("no channel %s", args[0])
+		}
+		channel, err := ChannelSet(config.Channels[i], field, value)
+		if err != nil {
+			return err
+		}
+		config.Channels[i] = channel
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return F("%s %s [%s]", args[0], field, value), nil
+}
+
+// ChannelMap is the channel fields keyed by the yaml names
+func ChannelMap(channel TgTubeChanChannel) (cm map[string]interface{}, err error) {
+	cbb, err := yaml.Marshal(channel)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(cbb, &cm); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// ChannelGet is the value of the channel field named as in yaml as ChannelSet takes it
+func ChannelGet(channel TgTubeChanChannel, field string) (string, error) {
+	cm, err := ChannelMap(channel)
+	if err != nil {
+		return "", err
+	}
+	v, ok := cm[field]
+	if !ok {
+		return "", fmt.Errorf("unknown field %s", field)
+	}
+	if v == nil {
+		return "", nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// ChannelSet returns a copy of channel with the field named as in yaml set to value
+func ChannelSet(channel TgTubeChanChannel, field, value string) (TgTubeChanChannel, error) {
+	cm, err := ChannelMap(channel)
+	if err != nil {
+		return channel, err
+	}
+	v, ok := cm[field]
+	if !ok || field == "YtLast" {
+		return channel, fmt.Errorf("unknown field %s", field)
+	}
+	if _, ok := v.(string); ok {
+		cm[field] = value
+	} else {
+		var vv interface{}
+		if err := yaml.Unmarshal([]byte(value), &vv); err != nil {
+			return channel, fmt.Errorf("value [%s] %v", value, err)
+		}
+		cm[field] = vv
+	}
+	cbb, err := yaml.Marshal(cm)
+	if err != nil {
+		return channel, err
+	}
+	var newchannel TgTubeChanChannel
+	if err := yaml.Unmarshal(cbb, &newchannel); err != nil {
+		return channel, fmt.Errorf("%s [%s] %v", field, value, err)
+	}
+	// the state of the channel and its sources is kept by their keys
+	if !slices.Equal(channelKeys(&newchannel), channelKeys(&channel)) {
+		return channel, fmt.Errorf("%s changes the channel key, remove the channel and add it again", field)
+	}
+	return newchannel, nil
+}
+
+// channelKeys are the keys of the channel and its sources
+func channelKeys(channel *TgTubeChanChannel) (keys []string) {
+	keys = append(keys, channel.Key())
+	for _, source := range channel.SourcesList() {
+		keys = append(keys, source.Key())
+	}
+	return keys
+}
+
+// TgSettingsToggles are the channel fields flipped by the settings keyboard buttons
+var TgSettingsToggles = []string{"TgSkipPhoto", "TgSkipDescription", "TgTitleUnquote", "TgChapterPosts", "Suspend"}
+
+// TgSettingsEdits are the channel fields set by the settings keyboard from the next message of the admin
+var TgSettingsEdits = []string{"TgPerformer", "TgTitleCleanRe", "YtCheckInterval", "TgMode", "TgAudioCodec", "TgLoudnessLufs", "TgCoverMode", "TgRemovedMode"}
+
+// TgSettingsEdit is a settings keyboard field edit waiting for the value message
+type TgSettingsEdit struct {
+	Key       string
+	Field     string
+	ChatId    int64
+	MessageId int64
+}
+
+// TgSettingsEditsPending are keyed by the admin user id and guarded by Mu
+var TgSettingsEditsPending = make(map[int64]TgSettingsEdit)
+
+// Toggle flips the bool channel field
+func (channel *TgTubeChanChannel) Toggle(field string) error {
+	switch field {
+	case "TgSkipPhoto":
+		channel.TgSkipPhoto = !channel.TgSkipPhoto
+	case "TgSkipDescription":
+		channel.TgSkipDescription = !channel.TgSkipDescription
+	case "TgTitleUnquote":
+		channel.TgTitleUnquote = !channel.TgTitleUnquote
+	case "TgChapterPosts":
+		channel.TgChapterPosts = !channel.TgChapterPosts
+	case "Suspend":
+		channel.Suspend = !channel.Suspend
+	default:
+		return fmt.Errorf("unknown toggle field %s", field)
+	}
+	return nil
+}
+
+// TgSettingsRender returns the text and the inline keyboard of the channel settings message
+func TgSettingsRender(key string) (text string, markup TgInlineKeyboardMarkup, err error) {
+	Mu.Lock()
+	defer Mu.Unlock()
+	i := Config.ChannelIndex(key)
+	if i < 0 {
+		return "", markup, fmt.Errorf("no channel %s", key)
+	}
+	channel := Config.Channels[i]
+	key = "@" + channel.Key()
+
+	text = tg.Bold(tg.Esc(key)) + NL + tg.Esc(channel.TgChatId)
+
+	toggles := map[string]bool{
+		"TgSkipPhoto":       channel.TgSkipPhoto,
+		"TgSkipDescription": channel.TgSkipDescription,
+		"TgTitleUnquote":    channel.TgTitleUnquote,
+		"TgChapterPosts":    channel.TgChapterPosts,
+		"Suspend":           channel.Suspend,
+	}
+	var row []TgInlineKeyboardButton
+	for _, field := range TgSettingsToggles {
+		mark := "✗"
+		if toggles[field] {
+			mark = "✓"
+		}
+		row = append(row, TgInlineKeyboardButton{
+			Text:         field + SP + mark,
+			CallbackData: F("toggle %s %s", key, field),
+		})
+		if len(row) == 2 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+
+	for _, field := range TgSettingsEdits {
+		value, err := ChannelGet(channel, field)
+		if err != nil {
+			return "", markup, err
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []TgInlineKeyboardButton{{
+			Text:         F("%s [%s]", field, value),
+			CallbackData: F("edit %s %s", key, field),
+		}})
+	}
+
+	return text, markup, nil
+}
+
+// TgSettingsSend sends the channel settings message with the inline keyboard
+func TgSettingsSend(chatid int64, key string) error {
+	text, markup, err := TgSettingsRender(key)
+	if err != nil {
+		text, markup = tg.Esc(F("ERROR %v", err)), TgInlineKeyboardMarkup{}
+	}
+	var msg tg.Message
+	return TgApiPost("sendMessage", TgSendMessageMarkupRequest{
+		ChatId:      tg.F("%d", chatid),
+		Text:        text,
+		ParseMode:   tg.ParseMode,
+		ReplyMarkup: &markup,
+	}, &msg)
+}
+
+// TgSettingsUpdate renders the settings message again after a change
+func TgSettingsUpdate(chatid, messageid int64, key string) error {
+	text, markup, err := TgSettingsRender(key)
+	if err != nil {
+		return err
+	}
+	var msg tg.Message
+	return TgApiPost("editMessageText", TgEditMessageTextMarkupRequest{
+		ChatId:      tg.F("%d", chatid),
+		MessageId:   messageid,
+		Text:        text,
+		ParseMode:   tg.ParseMode,
+		ReplyMarkup: &markup,
+	}, &msg)
+}
+
+// TgSettingsCallback handles the settings keyboard button presses
+func TgSettingsCallback(cq TgCallbackQuery) (err error) {
+	var answer string
+	defer func() {
+		if err != nil {
+			answer = F("ERROR %v", err)
+		}
+		var ok bool
+		if aerr := TgApiPost("answerCallbackQuery", TgAnswerCallbackQueryRequest{
+			CallbackQueryId: cq.Id,
+			Text:            answer,
+		}, &ok); aerr != nil {
+			perr(F("ERROR answerCallbackQuery %v", aerr))
+		}
+	}()
+
+	if !TgIsAdmin(cq.From.Id) {
+		perr(F("WARNING callback query from not admin user id <%d> @%s", cq.From.Id, cq.From.Username))
+		return nil
+	}
+
+	// action @YtUsername Field
+	ff := strings.Fields(cq.Data)
+	if len(ff) != 3 {
+		return fmt.Errorf("invalid callback data [%s]", cq.Data)
+	}
+	action, key, field := ff[0], ff[1], ff[2]
+
+	switch action {
+	case "toggle":
+		if err := ConfigEdit(func(config *TgTubeChanConfig) error {
+			i := config.ChannelIndex(key)
+			if i < 0 {
+				return fmt.Errorf("no channel %s", key)
+			}
+			return config.Channels[i].Toggle(field)
+		}); err != nil {
+			return err
+		}
+		answer = F("%s %s toggled", key, field)
+		return TgSettingsUpdate(cq.Message.Chat.Id, cq.Message.MessageId, key)
+
+	case "edit":
+		if !slices.Contains(TgSettingsEdits, field) {
+			return fmt.Errorf("unknown edit field %s", field)
+		}
+		Mu.Lock()
+		TgSettingsEditsPending[cq.From.Id] = TgSettingsEdit{
+			Key:       key,
+			Field:     field,
+			ChatId:    cq.Message.Chat.Id,
+			MessageId: cq.Message.MessageId,
+		}
+		Mu.Unlock()
+		answer = F("send the new %s for %s", field, key)
+		if _, err := tg.SendMessage(tg.SendMessageRequest{
+			ChatId: tg.F("%d", cq.Message.Chat.Id),
+			Text:   tg.Esc(answer + ", - to make it empty"),
+		}); err != nil {
+			return fmt.Errorf("tg.SendMessage %v", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown action %s", action)
+}
+
+// TgSettingsEditValue sets the field waiting for a value from the settings keyboard
+func TgSettingsEditValue(m tg.Message) error {
+	if m.Chat.Type != "private" || !TgIsAdmin(m.From.Id) {
+		return nil
+	}
+	Mu.Lock()
+	edit, ok := TgSettingsEditsPending[m.From.Id]
+	delete(TgSettingsEditsPending, m.From.Id)
+	Mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	value := m.Text
+	if value == "-" {
+		value = ""
+	}
+	reply := F("%s %s [%s]", edit.Key, edit.Field, value)
+	if err := ConfigEdit(func(config *TgTubeChanConfig) error {
+		i := config.ChannelIndex(edit.Key)
+		if i < 0 {
+			return fmt.Errorf("no channel %s", edit.Key)
+		}
+		channel, err := ChannelSet(config.Channels[i], edit.Field, value)
+		if err != nil {
+			return err
+		}
+		config.Channels[i] = channel
+		return nil
+	}); err != nil {
+		reply = F("ERROR %s %v", edit.Field, err)
+	} else if err := TgSettingsUpdate(edit.ChatId, edit.MessageId, edit.Key); err != nil {
+		perr(F("ERROR TgSettingsUpdate %v", err))
+	}
+
+	if _, err := tg.SendMessage(tg.SendMessageRequest{
+		ChatId: tg.F("%d", m.Chat.Id),
+		Text:   tg.Esc(reply),
+	}); err != nil {
+		return fmt.Errorf("tg.SendMessage %v", err)
+	}
+
+	return nil
+}
+
+// TgTubeChanItem is a video listed from one of the channel sources
+type TgTubeChanItem struct {
+	Source  *TgTubeChanChannel
+	State   *TgTubeChanChannelState
+	Snippet youtube.PlaylistItemSnippet
+}
+
+// processYtChannel posts the new videos of all the channel sources in publish order
+func processYtChannel(job *TgTubeChanJob) (err error) {
+	channel, config := &job.Channel, &job.Config
+
+	var items []TgTubeChanItem
+	seens := make(map[*TgTubeChanChannelState]map[string]bool)
+	// the sources with their states to check for edits
+	var checks []TgTubeChanItem
+
+	sources := channel.SourcesList()
+	for i := range sources {
+		source := &sources[i]
+		if job.Pushed != nil && len(job.Pushed[source.Key()]) == 0 {
+			continue
+		}
+
+		Mu.Lock()
+		chstate := State.Channel(source)
+		Mu.Unlock()
+
+		videos, seen, err := ytSourceVideos(job, source, chstate)
+		if err != nil {
+			// the pushed videos are kept for the retry only when the job fails
+			if len(sources) == 1 || job.Pushed != nil {
+				return err
+			}
+			// a broken source does not stop the others
+			tglog(F("ERROR %s %v", source.Key(), err))
+			continue
+		}
+		seens[chstate] = seen
+		checks = append(checks, TgTubeChanItem{Source: source, State: chstate})
+		for _, v := range videos {
+			items = append(items, TgTubeChanItem{Source: source, State: chstate, Snippet: v})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Snippet.PublishedAt < items[j].Snippet.PublishedAt })
+
+	for j, item := range items {
+		v := item.Snippet
+		perr(F(
+			"DEBUG %s <%d>/<%d> title [%s] url [youtu.be/%s] published <%s>",
+			item.Source.Key(), j+1, len(items), v.Title, v.ResourceId.VideoId, v.PublishedAt,
+		))
+
+		if err := processYtVideo(job, item.Source, item.State, v); err != nil {
+			return err
+		}
+
+		if len(items) > 3 {
+			perr(F("DEBUG %s sleeping <%v>", channel.Key(), config.TgPlaylistVideosInterval))
+			time.Sleep(config.TgPlaylistVideosInterval)
+		}
+	}
+
+	if (config.TgEditWindow > 0 || config.TgRemovedWindow > 0) && job.Pushed == nil {
+		for _, check := range checks {
+			Mu.Lock()
+			due := time.Since(check.State.TgEditCheckLast) >= config.TgEditInterval
+			Mu.Unlock()
+			if !due {
+				continue
+			}
+			if err := ytPostedCheck(job, check.Source, check.State); err != nil {
+				tglog(F("ERROR %s ytPostedCheck %v", check.Source.Key(), err))
+			}
+		}
+	}
+
+	Mu.Lock()
+	// the pushed jobs see only the pushed videos
+	if job.Pushed == nil {
+		for chstate, seen := range seens {
+			chstate.Prune(seen)
+		}
+	}
+	StateSave()
+	Mu.Unlock()
+
+	return nil
+}
+
+// ytSourceVideos lists the videos of the source not posted yet,
+// seen are the listed video ids to keep in the ledger
+func ytSourceVideos(job *TgTubeChanJob, channel *TgTubeChanChannel, chstate *TgTubeChanChannelState) (videos []youtube.PlaylistItemSnippet, seen map[string]bool, err error) {
+	config := &job.Config
+
+	Mu.Lock()
+	if channel.YtPlaylistId != "" && channel.YtPlaylistId != chstate.YtPlaylistId {
+		// the playlist is set or changed in the config, a changed one is listed from the start and its channel subscribed anew
+		tglog(F("%s YtPlaylistId [%s] was [%s]", channel.Key(), channel.YtPlaylistId, chstate.YtPlaylistId))
+		if chstate.YtPlaylistId != "" {
+			chstate.YtLast = ""
+		}
+		chstate.YtChannelId, chstate.YtPlaylistId = channel.YtChannelId, channel.YtPlaylistId
+		chstate.WebSubExpires, chstate.WebSubRequested, chstate.WebSubVideos = time.Time{}, time.Time{}, nil
+		StateSave()
+	}
+	playlistid := chstate.YtPlaylistId
+	Mu.Unlock()
+
+	if playlistid == "" {
+		if channel.YtUsername == "" && channel.YtChannelId == "" {
+			return nil, nil, fmt.Errorf("both YtUsername and YtChannelId empty")
+		}
+
+		// https://developers.google.com/youtube/v3/docs/channels/list
+
+		channelslistcall := job.YtSvc.Channels.List([]string{"id", "snippet", "contentDetails"}).MaxResults(11)
+		if channel.YtChannelId != "" {
+			channelslistcall = channelslistcall.Id(channel.YtChannelId)
+		} else if channel.YtUsername != "" {
+			// https://developers.google.com/youtube/v3/docs/channels/list#forHandle
+			channelslistcall = channelslistcall.ForHandle(channel.YtUsername)
+		}
+		channelslist, err := channelslistcall.Do()
+		if err != nil {
+			return nil, nil, fmt.Errorf("channels/list %v", err)
+		}
+
+		if len(channelslist.Items) == 0 {
+			return nil, nil, fmt.Errorf("channels/list empty result")
+		}
+
+		for _, c := range channelslist.Items {
+			tglog(F(
+				"DEBUG %s channel id [%s] title [%s] uploads playlist id <%v>",
+				channel.Key(), c.Id, c.Snippet.Title, c.ContentDetails.RelatedPlaylists.Uploads,
+			))
+		}
+		if len(channelslist.Items) > 1 {
+			return nil, nil, fmt.Errorf("channels/list more than one result")
+		}
+
+		playlistid = channelslist.Items[0].ContentDetails.RelatedPlaylists.Uploads
+
+		Mu.Lock()
+		chstate.YtChannelId = channelslist.Items[0].Id
+		chstate.YtPlaylistId = playlistid
+		StateSave()
+		Mu.Unlock()
+	}
+
+	Mu.Lock()
+	ytlast := chstate.YtLast
+	// a channel without ledger yet was posted up to the YtLast watermark
+	seeding := !chstate.Seeded
+	Mu.Unlock()
+
+	// the videos posted before the ledger are recorded only when the listing is complete
+	seeded := make(map[string]*TgTubeChanVideo)
+
+	// the YtLast watermark only cuts the pagination, YtLookback before it to see videos published late or re-dated,
+	// the ledger of video ids tells what is already posted
+	var cutoff string
+	if ytlast != "" {
+		ytlasttime, err := time.Parse(time.RFC3339, ytlast)
+		if err != nil {
+			return nil, nil, fmt.Errorf("time.Parse YtLast [%s] %v", ytlast, err)
+		}
+		cutoff = ytlasttime.Add(-config.YtLookback).UTC().Format(time.RFC3339)
+	}
+
+	// items of a playlist other than the channel uploads are not sorted by date,
+	// all of them are listed and the ledger alone tells what is posted
+	uploads := strings.HasPrefix(playlistid, "UU")
+	if !uploads {
+		cutoff = ""
+	}
+
+	seen = make(map[string]bool)
+
+	// consider adds the item to videos unless it is done, returns ENUFF for an item older than cutoff
+	consider := func(item *youtube.PlaylistItemSnippet) error {
+		// item.PublishedAt and cutoff are strings
+		if cutoff != "" && item.PublishedAt < cutoff {
+			return ENUFF
+		}
+		videoid := item.ResourceId.VideoId
+		seen[videoid] = true
+		if seeding && item.PublishedAt <= ytlast && chstate.Videos[videoid] == nil {
+			seeded[videoid] = &TgTubeChanVideo{
+				Status:      VideoPosted,
+				PublishedAt: item.PublishedAt,
+				Updated:     time.Now(),
+			}
+			return nil
+		}
+		if chstate.Videos[videoid].Done() {
+			return nil
+		}
+		videos = append(videos, *item)
+		return nil
+	}
+
+	pushed := job.Pushed[channel.Key()]
+	if seeding && len(pushed) > 0 {
+		// the pushed ids alone do not tell what was posted before the ledger
+		perr(F("DEBUG %s not seeded, listing instead of the pushed %v", channel.Key(), pushed))
+		pushed = nil
+	}
+	backfill := len(pushed) == 0
+	if len(pushed) > 0 {
+		items, err := ytVideosGet(job, pushed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ytVideosGet %v", err)
+		}
+		Mu.Lock()
+		for i := range items {
+			// the hub announces the updates of old videos too, consider skips them by cutoff
+			consider(&items[i])
+		}
+		Mu.Unlock()
+	} else if channel.YtSource == YtSourceFeed && uploads {
+		Mu.Lock()
+		channelid := chstate.ChannelId()
+		Mu.Unlock()
+
+		feeditems, err := ytFeedGet(job, channelid)
+		if err != nil {
+			perr(F("WARNING %s ytFeedGet %v, falling back to playlistitems/list", channel.Key(), err))
+		} else {
+			// the feed is enough when it reaches back to cutoff or has all the channel videos
+			backfill = cutoff == "" || len(feeditems) >= YtFeedEntriesMax && feeditems[len(feeditems)-1].PublishedAt >= cutoff
+			if backfill {
+				perr(F("DEBUG %s feed does not reach cutoff <%s>, backfilling with playlistitems/list", channel.Key(), cutoff))
+			} else {
+				Mu.Lock()
+				for i := range feeditems {
+					if consider(&feeditems[i]) == ENUFF {
+						break
+					}
+				}
+				Mu.Unlock()
+				if err := ytVideosFill(job, videos); err != nil {
+					return nil, nil, fmt.Errorf("ytVideosFill %v", err)
+				}
+			}
+		}
+	}
+
+	if backfill {
+		// https://developers.google.com/youtube/v3/docs/playlistItems/list
+		playlistitemslistcall := job.YtSvc.PlaylistItems.List([]string{"id", "snippet", "contentDetails"}).MaxResults(config.YtMaxResults)
+		playlistitemslistcall = playlistitemslistcall.PlaylistId(playlistid)
+		// TODO request results sorted by date asc
+		if err = playlistitemslistcall.Pages(
+			Ctx,
+			func(resp *youtube.PlaylistItemListResponse) error {
+				Mu.Lock()
+				defer Mu.Unlock()
+				for _, item := range resp.Items {
+					//log("DEBUG %s playlistitem %02d %s", channel.YtUsername, jitem+1, item.Snippet.PublishedAt)
+					// playlistitems/list results are sorted by date desc
+					// stop Pages after receiving an item older than cutoff
+					if err := consider(item.Snippet); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		); err != nil && err != ENUFF {
+			return nil, nil, fmt.Errorf("playlistitems/list %v", err)
+		}
+	}
+
+	if seeding {
+		Mu.Lock()
+		if chstate.Videos == nil {
+			chstate.Videos = make(map[string]*TgTubeChanVideo)
+		}
+		for videoid, video := range seeded {
+			if chstate.Videos[videoid] == nil {
+				chstate.Videos[videoid] = video
+			}
+		}
+		chstate.Seeded = true
+		StateSave()
+		Mu.Unlock()
+		perr(F("DEBUG %s seeded <%d> videos posted up to YtLast <%s>", channel.Key(), len(seeded), ytlast))
+	}
+
+	return videos, seen, nil
+}
+
+// processYtVideo posts the video v to the channel and records the outcome in the channel ledger
+func processYtVideo(job *TgTubeChanJob, channel *TgTubeChanChannel, chstate *TgTubeChanChannelState, v youtube.PlaylistItemSnippet) (err error) {
+	config := &job.Config
+
+	videoid := v.ResourceId.VideoId
+
+	Mu.Lock()
+	video := chstate.Videos[videoid]
+	if video == nil {
+		if chstate.Videos == nil {
+			chstate.Videos = make(map[string]*TgTubeChanVideo)
+		}
+		video = &TgTubeChanVideo{}
+		chstate.Videos[videoid] = video
+	}
+	prevvideo := *video
+
+	video.Status = VideoPending
+	video.PublishedAt = v.PublishedAt
+	video.Attempts++
+	video.Updated = time.Now()
+	StateSave()
+
+	// posted collects the message ids without holding Mu starting from the ones of the previous attempts
+	posted := &TgTubeChanVideo{
+		TgMessageIds:    slices.Clone(video.TgMessageIds),
+		TgMessageKinds:  slices.Clone(video.TgMessageKinds),
+		TgPostedChatIds: slices.Clone(video.TgPostedChatIds),
+	}
+	for chatid, ids := range video.TgDestMessageIds {
+		posted.MessageIdsSet(channel, chatid, slices.Clone(ids), slices.Clone(video.TgDestMessageKinds[chatid]))
+	}
+	Mu.Unlock()
+
+	status, err := postYtVideo(job, channel, v, posted)
+
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	video.TgMessageIds, video.TgMessageKinds = posted.TgMessageIds, posted.TgMessageKinds
+	video.TgDestMessageIds, video.TgDestMessageKinds = posted.TgDestMessageIds, posted.TgDestMessageKinds
+	video.TgPostedChatIds = posted.TgPostedChatIds
+	if posted.YtTitle != "" {
+		video.YtTitle, video.YtDescriptionSum = posted.YtTitle, posted.YtDescriptionSum
+		video.YtThumbUrl, video.YtThumbSum = posted.YtThumbUrl, posted.YtThumbSum
+		video.Duration, video.TgParts = posted.Duration, posted.TgParts
+		video.TgPhotoCaption, video.TgVideoCaption, video.TgAudioCaptions = posted.TgPhotoCaption, posted.TgVideoCaption, posted.TgAudioCaptions
+	}
+	if err != nil {
+		video.Status = VideoFailed
+		video.Error = err.Error()
+		if video.Attempts >= config.YtRetryMax {
+			tglog(F("ERROR %s youtu.be/%s giving up after <%d> attempts", channel.Key(), videoid, video.Attempts))
+			// the failed video is not retried anymore so it does not block the newer ones
+			err = nil
+		}
+	} else if status == "" {
+		// nothing posted, the video is going to be checked again
+		if prevvideo.Status == "" {
+			delete(chstate.Videos, videoid)
+		} else {
+			*video = prevvideo
+		}
+	} else {
+		video.Status = status
+		video.Error = ""
+		if v.PublishedAt > chstate.YtLast {
+			chstate.YtLast = v.PublishedAt
+		}
+	}
+	video.Updated = time.Now()
+
+	StateSave()
+
+	return err
+}
+
+// postYtVideo downloads the video v audio and sends it to the channel destinations not in video.TgPostedChatIds,
+// message ids of the posts are added to video.TgMessageIds and video.TgDestMessageIds
+func postYtVideo(job *TgTubeChanJob, channel *TgTubeChanChannel, v youtube.PlaylistItemSnippet, video *TgTubeChanVideo) (status string, err error) {
+	config := &job.Config
+
+	vpatime, err := time.Parse(time.RFC3339, v.PublishedAt)
+	if err != nil {
+		return "", fmt.Errorf("time.Parse PublishedAt [%s] %v", v.PublishedAt, err)
+	}
+
+	var dests []TgTubeChanDestination
+	for _, dest := range channel.DestinationsList() {
+		if !slices.Contains(video.TgPostedChatIds, dest.TgChatId) {
+			dests = append(dests, dest)
+		}
+	}
+	if len(dests) == 0 {
+		return VideoPosted, nil
+	}
+
+	// unpost deletes the messages left in the chat by a previous attempt failed in the middle of it
+	unpost := func(chatid string) {
+		ids, _ := video.MessageIds(channel, chatid)
+		for _, messageid := range ids {
+			if err := tg.DeleteMessage(tg.DeleteMessageRequest{
+				ChatId:    chatid,
+				MessageId: messageid,
+			}); err != nil {
+				perr(F("ERROR tg.DeleteMessage %v", err))
+			}
+		}
+		video.MessageIdsSet(channel, chatid, nil, nil)
+	}
+
+	// notify posts the text to all the destinations
+	notify := func(text string) error {
+		for _, dest := range dests {
+			unpost(dest.TgChatId)
+			msg, err := tg.SendMessage(tg.SendMessageRequest{
+				ChatId: dest.TgChatId,
+				Text:   text,
+
+				LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
+			})
+			if err != nil {
+				return fmt.Errorf("tg.SendMessage %v", err)
+			}
+			video.MessageIdsAdd(channel, dest.TgChatId, msg.MessageId, TgMessageNotice)
+			video.TgPostedChatIds = append(video.TgPostedChatIds, dest.TgChatId)
+		}
+		return nil
+	}
+
+	vinfo, err := job.YtdlCl.GetVideoContext(Ctx, v.ResourceId.VideoId)
+	if err != nil {
+
+		if _, ok := err.(*ytdl.ErrPlayabiltyStatus); ok {
+
+			// cannot playback and download, status: LIVE_STREAM_OFFLINE, reason: This live event will begin in a few moments.
+			if err.(*ytdl.ErrPlayabiltyStatus).Status == "LIVE_STREAM_OFFLINE" && time.Now().Sub(vpatime) > 24*time.Hour {
+				perr(F("DEBUG GetVideoContext skipping LIVE_STREAM_OFFLINE youtu.be/%s", v.ResourceId.VideoId))
+				return "", nil
+			}
+
+			// youtu.be/6L37mxTMxcQ Video unavailable. This video contains content from Beggars Group Digital, who has blocked it in your country on copyright grounds.
+			if err.(*ytdl.ErrPlayabiltyStatus).Status == "UNPLAYABLE" {
+				tgmsg := tg.Italic("UNPLAYABLE") + NL +
+					tg.Esc(tg.F(
+						"%s"+NL+"%s %s"+NL+"youtu.be/%s",
+						v.Title, channel.TgPerformer, vpatime.Format("2006/01/02"), v.ResourceId.VideoId,
+					))
+				if err := notify(tgmsg); err != nil {
+					return "", err
+				}
+
+				return VideoSkippedUnplayable, nil
+			}
+
+		}
+
+		// can't bypass age restriction: embedding of this video has been disabled
+		if err2 := errors.Unwrap(err); err2 != nil && err2.Error() == MsgEmbeddingDisabled {
+			tgmsg := tg.Italic(MsgEmbeddingDisabled) + NL +
+				tg.Esc(tg.F(
+					"%s"+NL+"%s %s"+NL+"youtu.be/%s",
+					v.Title, channel.TgPerformer, vpatime.Format("2006/01/02"), v.ResourceId.VideoId,
+				))
+			if err := notify(tgmsg); err != nil {
+				return "", err
+			}
+
+			return VideoSkippedAge, nil
+		}
+
+		// login required to confirm your age
+		if err.Error() == MsgLoginRequired {
+			tgmsg := tg.Italic(MsgLoginRequired) + NL +
+				tg.Esc(tg.F(
+					"%s"+NL+"%s %s"+NL+"youtu.be/%s",
+					v.Title, channel.TgPerformer, vpatime.Format("2006/01/02"), v.ResourceId.VideoId,
+				))
+			if err := notify(tgmsg); err != nil {
+				return "", err
+			}
+
+			return VideoSkippedAge, nil
+		}
+
+		return "", fmt.Errorf("GetVideoContext %#v"+NL+"%#v", err, v)
+
+	}
+
+	vtitle := ytTitleClean(channel, v.Title)
+
+	audioName := fmt.Sprintf(
+		"%04d%02d%02d.%02d%02d%02d.%s",
+		vpatime.Year(), vpatime.Month(), vpatime.Day(),
+		vpatime.Hour(), vpatime.Minute(), vpatime.Second(),
+		v.ResourceId.VideoId,
+	)
+
+	codec := channel.AudioCodec()
+	if config.FfmpegPath == "" {
+		codec = TgAudioCodecCopy
+	}
+
+	// opus streams are picked for opus to avoid encoding twice, mp4 aac for the rest
+	audioMimeType, audioSrcExt := "audio/mp4", "m4a"
+	if codec == TgAudioCodecOpus {
+		audioMimeType, audioSrcExt = "audio/webm", "webm"
+	}
+	// opus source not above the target bitrate is only remuxed
+	audioBitrateCopyMax := int(config.TgAudioBitrateKbps<<10) * 5 / 4
+
+	var audioFormat ytdl.Format
+	for _, f := range vinfo.Formats.WithAudioChannels() {
+		if !strings.HasPrefix(f.MimeType, audioMimeType) {
+			continue
+		}
+		perr(F("DEBUG format [%s] size <%dmb> AudioTrack %+v", f.MimeType, f.ContentLength>>20, f.AudioTrack))
+		if f.AudioTrack != nil && !strings.HasSuffix(f.AudioTrack.DisplayName, " original") {
+			continue
+		}
+		if codec == TgAudioCodecOpus && audioFormat.Bitrate > 0 {
+			// the biggest bitrate not above audioBitrateCopyMax or the smallest above it
+			fcopy, pickedcopy := f.Bitrate <= audioBitrateCopyMax, audioFormat.Bitrate <= audioBitrateCopyMax
+			if fcopy && (!pickedcopy || f.Bitrate > audioFormat.Bitrate) || !fcopy && !pickedcopy && f.Bitrate < audioFormat.Bitrate {
+				perr("DEBUG pick")
+				audioFormat = f
+			}
+			continue
+		}
+		if audioFormat.Bitrate == 0 || f.Bitrate > audioFormat.Bitrate {
+			perr("DEBUG pick")
+			audioFormat = f
+		}
+	}
+	if audioFormat.ItagNo == 0 {
+		return "", fmt.Errorf("no [%s] audio format", audioMimeType)
+	}
+
+	audioSrcFile := fmt.Sprintf("%s..%s", audioName, audioSrcExt)
+
+	t0dl := time.Now()
+	copywritten, err := ytDownload(job, vinfo, &audioFormat, audioSrcFile)
+	if err != nil {
+		return "", err
+	}
+
+	perr(F(
+		"DEBUG downloaded audio size <%dmb> bitrate <%dkbps> duration <%v> in <%v>",
+		copywritten>>20, audioFormat.Bitrate>>10, vinfo.Duration, time.Now().Sub(t0dl).Truncate(time.Second),
+	))
+
+	if expectsize := int(vinfo.Duration.Seconds()) * audioFormat.Bitrate / 8; copywritten < int64(expectsize/2) {
+		return "", fmt.Errorf("downloaded audio size is less than half of expected")
+	}
+
+	audioFile := audioSrcFile
+
+	if codec != TgAudioCodecCopy && config.TgAudioBitrateKbps > 0 {
+		perr(F("DEBUG target audio codec [%s] bitrate <%dkbps>", codec, config.TgAudioBitrateKbps))
+
+		var loudnorm string
+		if channel.TgLoudnessLufs != 0 {
+			perr(F("DEBUG target loudness <%vlufs>", channel.TgLoudnessLufs))
+			if loudnorm, err = ffmpegLoudnorm(config, audioSrcFile, channel.TgLoudnessLufs); err != nil {
+				perr(F("ERROR ffmpegLoudnorm %v", err))
+			}
+		}
+
+		var codecArgs []string
+		switch codec {
+		case TgAudioCodecOpus:
+			if loudnorm == "" && audioFormat.Bitrate <= audioBitrateCopyMax {
+				codecArgs = []string{"-c:a", "copy"}
+			} else {
+				codecArgs = []string{"-c:a", "libopus"}
+			}
+			audioFile = fmt.Sprintf("%s..%dk..ogg", audioName, config.TgAudioBitrateKbps)
+		case TgAudioCodecMp3:
+			codecArgs = []string{"-c:a", "libmp3lame"}
+			audioFile = fmt.Sprintf("%s..%dk..mp3", audioName, config.TgAudioBitrateKbps)
+		default:
+			codecArgs = []string{"-c:a", "aac"}
+			audioFile = fmt.Sprintf("%s..%dk..m4a", audioName, config.TgAudioBitrateKbps)
+		}
+		if codecArgs[1] != "copy" {
+			codecArgs = append(codecArgs, "-b:a", fmt.Sprintf("%dk", config.TgAudioBitrateKbps))
+		}
+		if loudnorm != "" {
+			// loudnorm resamples to 192khz
+			codecArgs = append([]string{"-af", loudnorm, "-ar", "48000"}, codecArgs...)
+		}
+		ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions), "-i", audioSrcFile, "-map", "0:a")
+		ffmpegArgs = append(ffmpegArgs, codecArgs...)
+		ffmpegArgs = append(ffmpegArgs, audioFile)
+		if err = ffmpegRun(config, ffmpegArgs); err != nil {
+			return "", err
+		}
+
+		if err = os.Remove(audioSrcFile); err != nil {
+			tglog(F("ERROR Remove %s %v", audioSrcFile, err))
+		}
+	}
+
+	defer func() {
+		if err := os.Remove(audioFile); err != nil {
+			perr(F("ERROR Remove [%s] %v", audioFile, err))
+		}
+	}()
+
+	thumbBytes, thumbSum, thumbImg, err := ytThumbGet(v.Thumbnails)
+	if err != nil {
+		return "", err
+	}
+	var dx, dy int
+	if thumbImg != nil {
+		dx, dy = thumbImg.Bounds().Dx(), thumbImg.Bounds().Dy()
+	}
+
+	chapters := ytChapters(v.Description, vinfo.Duration)
+	if len(chapters) > 0 {
+		perr(F("DEBUG chapters <%d>", len(chapters)))
+	}
+	if config.FfmpegPath != "" {
+		tags := AudioTags{
+			Title:   vtitle,
+			Artist:  channel.TgPerformer,
+			Album:   v.ChannelTitle,
+			Date:    vpatime.Format("2006-01-02"),
+			Comment: "youtu.be/" + v.ResourceId.VideoId,
+		}
+		if metadataEmbedFile, err := audioMetadataEmbed(config, audioFile, tags, thumbBytes, dx, dy, chapters); err != nil {
+			perr(F("ERROR audioMetadataEmbed %v", err))
+		} else {
+			audioFile = metadataEmbedFile
+		}
+	}
+
+	// the files are uploaded to the first destination once and posted by file ids to all the destinations
+
+	var tgcover tg.PhotoSize
+	if slices.ContainsFunc(dests, func(dest TgTubeChanDestination) bool { return !dest.TgSkipPhoto }) {
+		if tgmsg, err := tg.SendPhotoFile(tg.SendPhotoFileRequest{
+			ChatId:   dests[0].TgChatId,
+			FileName: audioName + "..photo",
+			Photo:    bytes.NewReader(thumbBytes),
+		}); err != nil {
+			return "", fmt.Errorf("ERROR tg.SendPhotoFile %v", err)
+		} else {
+			for _, p := range tgmsg.Photo {
+				if p.Width > tgcover.Width {
+					tgcover = p
+				}
+			}
+			if tgcover.FileId == "" {
+				return "", fmt.Errorf("ERROR tg.SendPhotoFile file_id empty")
+			}
+			if err := tg.DeleteMessage(tg.DeleteMessageRequest{
+				ChatId:    dests[0].TgChatId,
+				MessageId: tgmsg.MessageId,
+			}); err != nil {
+				perr(F("ERROR tg.DeleteMessage %v", err))
+			}
+		}
+	}
+
+	// the audio thumb is square not to be cropped by telegram
+	audioThumbBytes := thumbBytes
+	if channel.Mode() != TgModeVideo && thumbImg != nil {
+		var avatar image.Image
+		if channel.TgCoverMode == TgCoverAvatar {
+			var err error
+			// the playlist items of the other channels videos have the playlist owner ChannelId
+			ownerid := v.VideoOwnerChannelId
+			if ownerid == "" {
+				ownerid = v.ChannelId
+			}
+			if avatar, err = ytChannelAvatar(job, ownerid); err != nil {
+				perr(F("ERROR ytChannelAvatar %v", err))
+			}
+		}
+		if coverBytes, err := squareCover(thumbImg, channel.TgCoverMode, avatar); err != nil {
+			perr(F("ERROR squareCover %v", err))
+		} else {
+			perr(F("DEBUG audio thumb [%s] size <%dkb>", channel.TgCoverMode, len(coverBytes)>>10))
+			audioThumbBytes = coverBytes
+		}
+	}
+
+	// tgaudios are the audio parts not bigger than TgFileSizeMaxMb or the chapters
+	var parts []AudioPart
+	var tgaudios []tg.Audio
+	if channel.Mode() != TgModeVideo {
+		if channel.TgChapterPosts && len(chapters) > 0 && config.FfmpegPath != "" {
+			parts, err = audioChapterParts(config, audioFile, chapters)
+			if err != nil {
+				return "", fmt.Errorf("audioChapterParts %v", err)
+			}
+		} else {
+			var starts []time.Duration
+			for _, c := range chapters {
+				starts = append(starts, c.Start)
+			}
+			parts, err = audioSplit(config, audioFile, vinfo.Duration, starts)
+			if err != nil {
+				return "", fmt.Errorf("audioSplit %v", err)
+			}
+		}
+		for _, part := range parts {
+			if part.File != audioFile {
+				defer os.Remove(part.File)
+			}
+		}
+
+		for i, part := range parts {
+			audioSrc, err := os.Open(part.File)
+			if err != nil {
+				return "", fmt.Errorf("Open [%s] %v", part.File, err)
+			}
+			defer audioSrc.Close()
+
+			title, performer := vtitle, channel.TgPerformer
+			if part.Title != "" {
+				title = part.Title
+				if part.Performer != "" {
+					performer = part.Performer
+				}
+			} else if len(parts) > 1 {
+				title += F(" part %d/%d", i+1, len(parts))
+			}
+
+			if tgmsg, err := tg.SendAudioFile(tg.SendAudioFileRequest{
+				ChatId:    dests[0].TgChatId,
+				Performer: performer,
+				Title:     title,
+				Duration:  part.Duration,
+				Audio:     audioSrc,
+				Thumb:     bytes.NewReader(audioThumbBytes),
+			}); err != nil {
+				return "", fmt.Errorf("ERROR tg.SendAudioFile %v", err)
+			} else {
+				if err := tg.DeleteMessage(tg.DeleteMessageRequest{
+					ChatId:    dests[0].TgChatId,
+					MessageId: tgmsg.MessageId,
+				}); err != nil {
+					perr(F("ERROR tg.DeleteMessage %v", err))
+				}
+				// telegram keeps as audio only the files it can play, the opus ogg may come back as a voice or a document
+				if tgmsg.Audio.FileId == "" {
+					return "", fmt.Errorf("tg.SendAudioFile [%s] not taken as audio, TgAudioCodec [%s]", part.File, channel.TgAudioCodec)
+				}
+				tgaudios = append(tgaudios, tgmsg.Audio)
+			}
+		}
+	}
+
+	var tgvideo tg.Video
+	if channel.Mode() != TgModeAudio {
+		videoFile, width, height, err := ytVideoFile(job, channel, vinfo, audioFile, audioName)
+		if err != nil {
+			return "", fmt.Errorf("ytVideoFile %v", err)
+		}
+		defer os.Remove(videoFile)
+
+		videoSrc, err := os.Open(videoFile)
+		if err != nil {
+			return "", fmt.Errorf("Open [%s] %v", videoFile, err)
+		}
+		defer videoSrc.Close()
+
+		if tgmsg, err := TgSendVideoFile(TgSendVideoFileRequest{
+			ChatId:    dests[0].TgChatId,
+			FileName:  videoFile,
+			Video:     videoSrc,
+			Thumbnail: bytes.NewReader(thumbBytes),
+			Width:     width,
+			Height:    height,
+			Duration:  vinfo.Duration,
+		}); err != nil {
+			return "", fmt.Errorf("TgSendVideoFile %v", err)
+		} else {
+			tgvideo = tgmsg.Video
+			if err := tg.DeleteMessage(tg.DeleteMessageRequest{
+				ChatId:    dests[0].TgChatId,
+				MessageId: tgmsg.MessageId,
+			}); err != nil {
+				perr(F("ERROR tg.DeleteMessage %v", err))
+			}
+		}
+	}
+
+	// the posted video is recorded to edit the posts when it changes
+	video.YtTitle = v.Title
+	video.YtDescriptionSum = sha256Hex([]byte(v.Description))
+	video.YtThumbUrl, video.YtThumbSum = ytThumbUrl(v.Thumbnails), thumbSum
+	video.Duration = vinfo.Duration
+	for _, part := range parts {
+		video.TgParts = append(video.TgParts, TgTubeChanPart{Start: part.Start, Duration: part.Duration, Title: part.Title})
+	}
+
+	captions, err := ytVideoCaptions(job, channel, v, vinfo.Duration, vinfo.Views, video.TgParts)
+	if err != nil {
+		return "", err
+	}
+	video.TgPhotoCaption, video.TgVideoCaption, video.TgAudioCaptions = captions.Photo, captions.Video, captions.Audios
+
+	for _, dest := range dests {
+
+		unpost(dest.TgChatId)
+
+		if !dest.TgSkipPhoto {
+			if tgmsg, err := tg.SendPhoto(tg.SendPhotoRequest{
+				ChatId:  dest.TgChatId,
+				Photo:   tgcover.FileId,
+				Caption: captions.Photo,
+			}); err != nil {
+				return "", fmt.Errorf("tg.SendPhoto %v", err)
+			} else {
+				video.MessageIdsAdd(channel, dest.TgChatId, tgmsg.MessageId, TgMessagePhoto)
+			}
+		}
+
+		for i, tgaudio := range tgaudios {
+			if tgmsg, err := tg.SendAudio(tg.SendAudioRequest{
+				ChatId:  dest.TgChatId,
+				Audio:   tgaudio.FileId,
+				Caption: captions.Audios[i],
+			}); err != nil {
+				return "", fmt.Errorf("tg.SendAudio %v", err)
+			} else {
+				video.MessageIdsAdd(channel, dest.TgChatId, tgmsg.MessageId, TgMessageAudio)
+			}
+		}
+
+		if tgvideo.FileId != "" {
+			var tgmsg tg.Message
+			if err := TgApiPost("sendVideo", TgSendVideoRequest{
+				ChatId:            dest.TgChatId,
+				Video:             tgvideo.FileId,
+				Caption:           captions.Video,
+				ParseMode:         tg.ParseMode,
+				SupportsStreaming: true,
+			}, &tgmsg); err != nil {
+				return "", fmt.Errorf("sendVideo %v", err)
+			}
+			video.MessageIdsAdd(channel, dest.TgChatId, tgmsg.MessageId, TgMessageVideo)
+		}
+
+		if !dest.TgSkipDescription {
+			for _, text := range captions.Descriptions {
+				tgmsg, err := tg.SendMessage(tg.SendMessageRequest{
+					ChatId: dest.TgChatId,
+					Text:   text,
+
+					LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
+				})
+				if err != nil {
+					return "", fmt.Errorf("tg.SendMessage %v", err)
+				}
+				video.MessageIdsAdd(channel, dest.TgChatId, tgmsg.MessageId, TgMessageDescription)
+			}
+		}
+
+		video.TgPostedChatIds = append(video.TgPostedChatIds, dest.TgChatId)
+
+	}
+
+	return VideoPosted, nil
+}
+
+// ytTitleClean is the title cleaned by the channel TgTitleCleanRe and TgTitleUnquote
+func ytTitleClean(channel *TgTubeChanChannel, title string) string {
+	if channel.TgTitleCleanRe != "" {
+		// validated by ConfigCheck
+		if re, err := regexp.Compile(channel.TgTitleCleanRe); err == nil {
+			title = re.ReplaceAllString(title, "")
+		}
+	}
+
+	if channel.TgTitleUnquote {
+		if strings.HasPrefix(title, `"`) && strings.HasSuffix(title, `"`) {
+			title = strings.Trim(title, `"`)
+		}
+		if strings.HasPrefix(title, `«`) && strings.HasSuffix(title, `»`) {
+			title = strings.Trim(title, `«`)
+			title = strings.Trim(title, `»`)
+		}
+		for strings.Contains(title, `"`) {
+			title = strings.Replace(title, `"`, `«`, 1)
+			title = strings.Replace(title, `"`, `»`, 1)
+		}
+	}
+
+	return title
+}
+
+// ytThumbGet downloads the biggest thumbnail, sum is of the downloaded bytes,
+// webp is converted to png, img is nil when it does not decode
+func ytThumbGet(thumbs *youtube.ThumbnailDetails) (thumbBytes []byte, sum string, img image.Image, err error) {
+	thumbUrl := ytThumbUrl(thumbs)
+	if thumbUrl == "" {
+		return nil, "", nil, fmt.Errorf("no thumb url")
+	}
+
+	thumbBytes, err = downloadFile(thumbUrl)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("download thumb url [%s] %v", thumbUrl, err)
+	}
+	sum = sha256Hex(thumbBytes)
+
+	img, imgFmt, err := image.Decode(bytes.NewReader(thumbBytes))
+	if err != nil {
+		perr(F("ERROR thumb url [%s] decode %v", thumbUrl, err))
+		return thumbBytes, sum, nil, nil
+	}
+	perr(F("DEBUG thumb url [%s] fmt [%s] size <%dkb> res <%dx%d>", thumbUrl, imgFmt, len(thumbBytes)>>10, img.Bounds().Dx(), img.Bounds().Dy()))
+	if imgFmt == "webp" {
+		thumbPngBuf := new(bytes.Buffer)
+		png.Encode(thumbPngBuf, img)
+		thumbBytes = thumbPngBuf.Bytes()
+		perr(F("DEBUG thumb url [%s] converted to fmt [png] size <%dkb>", thumbUrl, len(thumbBytes)>>10))
+	}
+
+	return thumbBytes, sum, img, nil
+}
+
+// ytThumbUrl is the url of the biggest thumbnail
+func ytThumbUrl(thumbs *youtube.ThumbnailDetails) string {
+	if thumbs == nil {
+		return ""
+	}
+	for _, t := range []*youtube.Thumbnail{thumbs.Maxres, thumbs.Standard, thumbs.High, thumbs.Medium, thumbs.Default} {
+		if t != nil && t.Url != "" {
+			return t.Url
+		}
+	}
+	return ""
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// TgTubeChanCaptions are the rendered captions and description messages of a video
+type TgTubeChanCaptions struct {
+	Photo        string
+	Video        string
+	Audios       []string // of the parts
+	Descriptions []string
+}
+
+// ytVideoCaptions renders the channel templates for the video posted as the audio parts,
+// the captions of the media leave room for TgRemovedNoteCaption with the channel TgRemovedMode note
+func ytVideoCaptions(job *TgTubeChanJob, channel *TgTubeChanChannel, v youtube.PlaylistItemSnippet, duration time.Duration, views int, parts []TgTubeChanPart) (captions TgTubeChanCaptions, err error) {
+	config := &job.Config
+
+	captionSizeMax := TgCaptionSizeMax
+	if channel.RemovedMode() == TgRemovedNote {
+		captionSizeMax -= tgTextLen(TgRemovedNoteCaption)
+	}
+
+	vpatime, err := time.Parse(time.RFC3339, v.PublishedAt)
+	if err != nil {
+		return captions, fmt.Errorf("time.Parse PublishedAt [%s] %v", v.PublishedAt, err)
+	}
+
+	photoTemplate, err := captionTemplate(channel.TgPhotoCaptionTemplate, TgPhotoCaptionTemplateDefault)
+	if err != nil {
+		return captions, err
+	}
+	audioTemplate, err := captionTemplate(channel.TgAudioCaptionTemplate, TgAudioCaptionTemplateDefault)
+	if err != nil {
+		return captions, err
+	}
+	descriptionTemplate, err := captionTemplate(channel.TgDescriptionTemplate, TgDescriptionTemplateDefault)
+	if err != nil {
+		return captions, err
+	}
+
+	tz, err := time.LoadLocation(config.TgTimezone)
+	if err != nil {
+		return captions, fmt.Errorf("LoadLocation TgTimezone [%s] %v", config.TgTimezone, err)
+	}
+
+	// render falls back to the default template when the channel one fails or does not fit
+	render := func(tmpl *template.Template, textDefault string, data TgTubeChanCaption, size int) (string, error) {
+		text, err := captionRender(tmpl, data, size)
+		if err == nil {
+			return text, nil
+		}
+		perr(F("ERROR %s youtu.be/%s captionRender %v, using the default template", channel.Key(), v.ResourceId.VideoId, err))
+		tmpl, err = captionTemplate("", textDefault)
+		if err != nil {
+			return "", err
+		}
+		return captionRender(tmpl, data, size)
+	}
+
+	captionData := TgTubeChanCaption{
+		Title:       v.Title,
+		CleanTitle:  ytTitleClean(channel, v.Title),
+		Description: v.Description,
+		Performer:   channel.TgPerformer,
+		Duration:    duration,
+		Views:       views,
+		PublishedAt: vpatime.In(tz),
+		VideoId:     v.ResourceId.VideoId,
+		Url:         "https://youtu.be/" + v.ResourceId.VideoId,
+		Part:        1,
+		Parts:       1,
+
+		job:  job,
+		tags: &TgTubeChanCaptionTags{},
+	}
+
+	if captions.Photo, err = render(photoTemplate, TgPhotoCaptionTemplateDefault, captionData, captionSizeMax); err != nil {
+		return captions, err
+	}
+
+	if captions.Video, err = render(audioTemplate, TgAudioCaptionTemplateDefault, captionData, captionSizeMax); err != nil {
+		return captions, err
+	}
+
+	chapters := ytChapters(v.Description, duration)
+	for i, part := range parts {
+		data := captionData
+		data.Part, data.Parts = i+1, len(parts)
+		data.PartTitle = part.Title
+		if part.Title == "" {
+			// telegram makes the timestamps in the captions of audios clickable
+			data.Chapters = chaptersCaption(chapters, part.Start, part.Start+part.Duration)
+		}
+		caption, err := render(audioTemplate, TgAudioCaptionTemplateDefault, data, captionSizeMax)
+		if err != nil {
+			return captions, err
+		}
+		captions.Audios = append(captions.Audios, caption)
+	}
+
+	var spp []string
+	if len(v.Description) < 4000 {
+		spp = []string{v.Description}
+	} else {
+		var sp string
+		srs := strings.Split(v.Description, NL+NL)
+		for i, s := range srs {
+			sp += s + NL + NL
+			if i == len(srs)-1 || len(sp)+len(srs[i+1]) > 4000 {
+				spp = append(spp, sp)
+				sp = ""
+			}
+		}
+	}
+
+	for _, sp := range spp {
+		if strings.TrimSpace(sp) == "" {
+			continue
+		}
+		data := captionData
+		data.Text = sp
+		text, err := render(descriptionTemplate, TgDescriptionTemplateDefault, data, TgMessageSizeMax)
+		if err != nil {
+			return captions, err
+		}
+		if strings.TrimSpace(text) != "" {
+			captions.Descriptions = append(captions.Descriptions, text)
+		}
+	}
+
+	return captions, nil
+}
+
+// ytPostedCheck edits the posts of the recently posted videos of the channel when their title, description or thumbnail change
+// and handles the videos removed from youtube by the channel TgRemovedMode
+func ytPostedCheck(job *TgTubeChanJob, channel *TgTubeChanChannel, chstate *TgTubeChanChannelState) error {
+	config := &job.Config
+
+	Mu.Lock()
+	var videoids []string
+	posted := make(map[string]TgTubeChanVideo)
+	published := make(map[string]time.Duration)
+	for videoid, video := range chstate.Videos {
+		// the removed videos are checked again to be restored when available
+		if video.Status != VideoPosted && video.Status != VideoRemoved {
+			continue
+		}
+		patime, err := time.Parse(time.RFC3339, video.PublishedAt)
+		if err != nil || time.Since(patime) > max(config.TgEditWindow, config.TgRemovedWindow) {
+			continue
+		}
+		if video.Status == VideoRemoved && time.Since(patime) > config.TgRemovedWindow {
+			continue
+		}
+		videoids = append(videoids, videoid)
+		posted[videoid] = video.Copy()
+		published[videoid] = time.Since(patime)
+	}
+	chstate.TgEditCheckLast = time.Now()
+	StateSave()
+	Mu.Unlock()
+
+	if len(videoids) == 0 {
+		return nil
+	}
+
+	videos, err := ytVideosList(job, videoids)
+	if err != nil {
+		return err
+	}
+
+	// the deleted videos and the videos of the deleted channels are missing in videos/list,
+	// the private, rejected, failed and blocked ones are listed with the status not public and processed
+	removed := make(map[string]bool)
+	for _, videoid := range videoids {
+		removed[videoid] = published[videoid] <= config.TgRemovedWindow
+	}
+	for _, ytvideo := range videos {
+		if ytvideo.Status != nil && (ytvideo.Status.UploadStatus != "processed" || ytvideo.Status.PrivacyStatus == "private") {
+			perr(F("DEBUG %s youtu.be/%s uploadStatus [%s] privacyStatus [%s]", channel.Key(), ytvideo.Id, ytvideo.Status.UploadStatus, ytvideo.Status.PrivacyStatus))
+			continue
+		}
+		removed[ytvideo.Id] = false
+	}
+	for _, videoid := range videoids {
+		video := posted[videoid]
+		if removed[videoid] == (video.Status == VideoRemoved) {
+			continue
+		}
+
+		if !removed[videoid] {
+			// the video is public again, the deleted posts are not posted again
+			tglog(F("%s youtu.be/%s [%s] available on youtube again", channel.Key(), videoid, video.YtTitle))
+			if channel.RemovedMode() == TgRemovedNote {
+				if err := tgCaptionsEdit(channel, videoid, &video, ""); err != nil {
+					tglog(F("ERROR %s youtu.be/%s tgCaptionsEdit %v", channel.Key(), videoid, err))
+					continue
+				}
+			}
+			Mu.Lock()
+			if video := chstate.Videos[videoid]; video != nil {
+				video.Status = VideoPosted
+				video.Updated = time.Now()
+				StateSave()
+			}
+			Mu.Unlock()
+			continue
+		}
+
+		if err := removedYtVideo(channel, videoid, &video); err != nil {
+			tglog(F("ERROR %s youtu.be/%s removedYtVideo %v", channel.Key(), videoid, err))
+			continue
+		}
+		Mu.Lock()
+		if video := chstate.Videos[videoid]; video != nil {
+			video.Status = VideoRemoved
+			video.Updated = time.Now()
+			if channel.RemovedMode() == TgRemovedDelete {
+				video.TgMessageIds, video.TgMessageKinds = nil, nil
+				video.TgDestMessageIds, video.TgDestMessageKinds = nil, nil
+			}
+			StateSave()
+		}
+		Mu.Unlock()
+	}
+
+	for _, ytvideo := range videos {
+		video := posted[ytvideo.Id]
+		// the videos posted before the ledger recorded the posts are not edited
+		if removed[ytvideo.Id] || config.TgEditWindow == 0 || published[ytvideo.Id] > config.TgEditWindow || video.YtTitle == "" {
+			continue
+		}
+		v := ytVideoSnippet(ytvideo)
+
+		// youtube adds the bigger sizes of the same thumbnail hours after the upload,
+		// so a new url only resets the sum and the thumbnail changes when the picture of the same url does
+		var thumbBytes []byte
+		thumbUrl, thumbSum := video.YtThumbUrl, video.YtThumbSum
+		if b, sum, _, err := ytThumbGet(v.Thumbnails); err != nil {
+			perr(F("ERROR %s youtu.be/%s ytThumbGet %v", channel.Key(), ytvideo.Id, err))
+		} else if u := ytThumbUrl(v.Thumbnails); u != video.YtThumbUrl {
+			perr(F("DEBUG %s youtu.be/%s thumb url [%s] was [%s]", channel.Key(), ytvideo.Id, u, video.YtThumbUrl))
+			thumbUrl, thumbSum = u, sum
+		} else if sum != video.YtThumbSum {
+			thumbBytes, thumbSum = b, sum
+		}
+		titleChanged := v.Title != video.YtTitle
+		descriptionChanged := sha256Hex([]byte(v.Description)) != video.YtDescriptionSum
+		thumbChanged := thumbBytes != nil
+		if !titleChanged && !descriptionChanged && !thumbChanged {
+			if thumbUrl != video.YtThumbUrl {
+				Mu.Lock()
+				if video := chstate.Videos[ytvideo.Id]; video != nil {
+					video.YtThumbUrl, video.YtThumbSum = thumbUrl, thumbSum
+					StateSave()
+				}
+				Mu.Unlock()
+			}
+			continue
+		}
+
+		tglog(F(
+			"DEBUG %s youtu.be/%s changed title <%v> description <%v> thumb <%v>",
+			channel.Key(), ytvideo.Id, titleChanged, descriptionChanged, thumbChanged,
+		))
+
+		var views int
+		if ytvideo.Statistics != nil {
+			views = int(ytvideo.Statistics.ViewCount)
+		}
+		err := editYtVideo(job, channel, v, views, &video, titleChanged, descriptionChanged, thumbBytes)
+
+		Mu.Lock()
+		if ledgervideo := chstate.Videos[ytvideo.Id]; ledgervideo != nil {
+			// the description messages posted and deleted by the edit
+			ledgervideo.TgMessageIds, ledgervideo.TgMessageKinds = video.TgMessageIds, video.TgMessageKinds
+			ledgervideo.TgDestMessageIds, ledgervideo.TgDestMessageKinds = video.TgDestMessageIds, video.TgDestMessageKinds
+			if err == nil {
+				ledgervideo.YtTitle = v.Title
+				ledgervideo.YtDescriptionSum = sha256Hex([]byte(v.Description))
+				ledgervideo.YtThumbUrl, ledgervideo.YtThumbSum = thumbUrl, thumbSum
+				ledgervideo.TgPhotoCaption, ledgervideo.TgVideoCaption, ledgervideo.TgAudioCaptions = video.TgPhotoCaption, video.TgVideoCaption, video.TgAudioCaptions
+			}
+			StateSave()
+		}
+		Mu.Unlock()
+
+		if err != nil {
+			tglog(F("ERROR %s youtu.be/%s editYtVideo %v", channel.Key(), ytvideo.Id, err))
+		}
+	}
+
+	return nil
+}
+
+// editYtVideo edits the posts of the video to the changed v, thumbBytes is the changed thumbnail or nil,
+// the description pieces more or less than posted are sent or deleted and recorded in the video message ids
+func editYtVideo(job *TgTubeChanJob, channel *TgTubeChanChannel, v youtube.PlaylistItemSnippet, views int, video *TgTubeChanVideo, titleChanged, descriptionChanged bool, thumbBytes []byte) error {
+	captions, err := ytVideoCaptions(job, channel, v, video.Duration, views, video.TgParts)
+	if err != nil {
+		return err
+	}
+	video.TgPhotoCaption, video.TgVideoCaption, video.TgAudioCaptions = captions.Photo, captions.Video, captions.Audios
+
+	// the thumbnail is uploaded once and reused by file id
+	var photoFileId string
+
+	for _, dest := range channel.DestinationsList() {
+		ids, kinds := video.MessageIds(channel, dest.TgChatId)
+		var audioi, descriptioni int
+		for i, messageid := range ids {
+			if i >= len(kinds) {
+				break
+			}
+
+			var caption string
+			switch kinds[i] {
+			case TgMessagePhoto:
+				if thumbBytes != nil {
+					photoFileId, err = TgEditMessagePhoto(dest.TgChatId, messageid, thumbBytes, photoFileId, captions.Photo)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				if titleChanged {
+					caption = captions.Photo
 				}
-				if err := Config.Put(); err != nil {
-					return fmt.Errorf("Config.Put %v", err)
+			case TgMessageAudio:
+				if audioi < len(captions.Audios) {
+					caption = captions.Audios[audioi]
 				}
+				audioi++
+			case TgMessageVideo:
+				caption = captions.Video
+			case TgMessageDescription:
+				if descriptionChanged {
+					if descriptioni < len(captions.Descriptions) {
+						if _, err := tg.EditMessageText(tg.EditMessageTextRequest{
+							ChatId:    dest.TgChatId,
+							MessageId: messageid,
+							Text:      captions.Descriptions[descriptioni],
+
+							LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
+						}); err != nil && !TgNotModified(err) {
+							return fmt.Errorf("tg.EditMessageText %v", err)
+						}
+					} else {
+						if err := tg.DeleteMessage(tg.DeleteMessageRequest{
+							ChatId:    dest.TgChatId,
+							MessageId: messageid,
+						}); err != nil {
+							perr(F("ERROR tg.DeleteMessage %v", err))
+						}
+						video.MessageIdsRemove(channel, dest.TgChatId, messageid)
+					}
+				}
+				descriptioni++
+			}
+
+			if caption == "" {
+				continue
+			}
+			if err := TgEditMessageCaption(dest.TgChatId, messageid, caption); err != nil {
+				return err
+			}
+		}
+
+		if !descriptionChanged || dest.TgSkipDescription {
+			continue
+		}
+		for _, text := range captions.Descriptions[min(descriptioni, len(captions.Descriptions)):] {
+			tgmsg, err := tg.SendMessage(tg.SendMessageRequest{
+				ChatId: dest.TgChatId,
+				Text:   text,
+
+				LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
+			})
+			if err != nil {
+				return fmt.Errorf("tg.SendMessage %v", err)
+			}
+			video.MessageIdsAdd(channel, dest.TgChatId, tgmsg.MessageId, TgMessageDescription)
+		}
+	}
+
+	return nil
+}
+
+// removedYtVideo reports the video removed from youtube and deletes or notes its posts by the channel TgRemovedMode
+func removedYtVideo(channel *TgTubeChanChannel, videoid string, video *TgTubeChanVideo) error {
+	tglog(F("%s youtu.be/%s [%s] removed from youtube, %s", channel.Key(), videoid, video.YtTitle, channel.RemovedMode()))
+
+	switch channel.RemovedMode() {
+
+	case TgRemovedDelete:
+		for _, dest := range channel.DestinationsList() {
+			ids, _ := video.MessageIds(channel, dest.TgChatId)
+			for _, messageid := range ids {
+				if err := tg.DeleteMessage(tg.DeleteMessageRequest{
+					ChatId:    dest.TgChatId,
+					MessageId: messageid,
+				}); err != nil {
+					perr(F("ERROR tg.DeleteMessage %v", err))
+				}
+			}
+		}
+
+	case TgRemovedNote:
+		return tgCaptionsEdit(channel, videoid, video, TgRemovedNoteCaption)
+
+	}
+
+	return nil
+}
+
+// tgCaptionsEdit sets the captions of the photo, video and audio posts of the video to the ones recorded at posting with note added
+func tgCaptionsEdit(channel *TgTubeChanChannel, videoid string, video *TgTubeChanVideo, note string) error {
+	if video.TgPhotoCaption == "" && video.TgVideoCaption == "" && len(video.TgAudioCaptions) == 0 {
+		perr(F("DEBUG %s youtu.be/%s no captions in the ledger", channel.Key(), videoid))
+		return nil
+	}
+	for _, dest := range channel.DestinationsList() {
+		ids, kinds := video.MessageIds(channel, dest.TgChatId)
+		var audioi int
+		for i, messageid := range ids {
+			if i >= len(kinds) {
+				break
+			}
+			var caption string
+			switch kinds[i] {
+			case TgMessagePhoto:
+				caption = video.TgPhotoCaption
+			case TgMessageAudio:
+				if audioi < len(video.TgAudioCaptions) {
+					caption = video.TgAudioCaptions[audioi]
+				}
+				audioi++
+			case TgMessageVideo:
+				caption = video.TgVideoCaption
+			}
+			if caption == "" {
+				continue
+			}
+			if err := TgEditMessageCaption(dest.TgChatId, messageid, caption+note); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TgEditMessageCaption replaces the caption of the message, the same caption is not an error
+func TgEditMessageCaption(chatid string, messageid int64, caption string) error {
+	if err := TgApiPost("editMessageCaption", TgEditMessageCaptionRequest{
+		ChatId:    chatid,
+		MessageId: messageid,
+		Caption:   caption,
+		ParseMode: tg.ParseMode,
+	}, nil); err != nil && !TgNotModified(err) {
+		return fmt.Errorf("editMessageCaption %v", err)
+	}
+	return nil
+}
+
+// TgNotModified tells if the edit failed as the message is the same
+func TgNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
+
+// TgEditMessagePhoto replaces the photo of the message uploading photo or by fileid when it is not empty,
+// returns the file id of the new photo
+func TgEditMessagePhoto(chatid string, messageid int64, photo []byte, fileid, caption string) (string, error) {
+	media := TgInputMediaPhoto{Type: "photo", Media: fileid, Caption: caption, ParseMode: tg.ParseMode}
+	var msg tg.Message
+	if fileid != "" {
+		if err := TgApiPost("editMessageMedia", TgEditMessageMediaRequest{
+			ChatId:    chatid,
+			MessageId: messageid,
+			Media:     media,
+		}, &msg); err != nil && !TgNotModified(err) {
+			return "", err
+		}
+		return fileid, nil
+	}
+
+	media.Media = "attach://photo"
+	mediajson, err := json.Marshal(media)
+	if err != nil {
+		return "", err
+	}
+	if err := TgApiPostMultipart("editMessageMedia", map[string]string{
+		"chat_id":    chatid,
+		"message_id": strconv.FormatInt(messageid, 10),
+		"media":      string(mediajson),
+	}, []TgApiFile{{Field: "photo", Name: "photo", Reader: bytes.NewReader(photo)}}, &msg); err != nil {
+		return "", err
+	}
+	var width int64
+	for _, p := range msg.Photo {
+		if p.Width > width {
+			width, fileid = p.Width, p.FileId
+		}
+	}
+	return fileid, nil
+}
+
+// TgUpdate is tg.Update with the fields the tg package does not have
+type TgUpdate struct {
+	tg.Update
+
+	CallbackQuery TgCallbackQuery `json:"callback_query"`
+}
+
+type TgCallbackQuery struct {
+	// https://core.telegram.org/bots/api#callbackquery
+	Id      string     `json:"id"`
+	From    tg.User    `json:"from"`
+	Message tg.Message `json:"message"`
+	Data    string     `json:"data"`
+}
+
+type TgInlineKeyboardButton struct {
+	// https://core.telegram.org/bots/api#inlinekeyboardbutton
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type TgInlineKeyboardMarkup struct {
+	// https://core.telegram.org/bots/api#inlinekeyboardmarkup
+	InlineKeyboard [][]TgInlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type TgSendMessageMarkupRequest struct {
+	// https://core.telegram.org/bots/api#sendmessage
+	ChatId      string                  `json:"chat_id"`
+	Text        string                  `json:"text"`
+	ParseMode   string                  `json:"parse_mode,omitempty"`
+	ReplyMarkup *TgInlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type TgEditMessageTextMarkupRequest struct {
+	// https://core.telegram.org/bots/api#editmessagetext
+	ChatId      string                  `json:"chat_id"`
+	MessageId   int64                   `json:"message_id"`
+	Text        string                  `json:"text"`
+	ParseMode   string                  `json:"parse_mode,omitempty"`
+	ReplyMarkup *TgInlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type TgAnswerCallbackQueryRequest struct {
+	// https://core.telegram.org/bots/api#answercallbackquery
+	CallbackQueryId string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+}
+
+type TgEditMessageCaptionRequest struct {
+	// https://core.telegram.org/bots/api#editmessagecaption
+	ChatId    string `json:"chat_id"`
+	MessageId int64  `json:"message_id"`
+	Caption   string `json:"caption"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+type TgInputMediaPhoto struct {
+	// https://core.telegram.org/bots/api#inputmediaphoto
+	Type      string `json:"type"`
+	Media     string `json:"media"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+type TgEditMessageMediaRequest struct {
+	// https://core.telegram.org/bots/api#editmessagemedia
+	ChatId    string            `json:"chat_id"`
+	MessageId int64             `json:"message_id"`
+	Media     TgInputMediaPhoto `json:"media"`
+}
+
+type TgSendVideoRequest struct {
+	// https://core.telegram.org/bots/api#sendvideo
+	ChatId            string `json:"chat_id"`
+	Video             string `json:"video"`
+	Caption           string `json:"caption,omitempty"`
+	ParseMode         string `json:"parse_mode,omitempty"`
+	SupportsStreaming bool   `json:"supports_streaming"`
+}
+
+// TgSendVideoFileRequest is tg.SendVideoFileRequest with the thumbnail and streaming
+type TgSendVideoFileRequest struct {
+	// https://core.telegram.org/bots/api#sendvideo
+	ChatId    string
+	FileName  string
+	Video     io.Reader
+	Thumbnail io.Reader
+	Width     int
+	Height    int
+	Duration  time.Duration
+}
+
+// TgSendVideoFile uploads the video streaming the multipart request body
+func TgSendVideoFile(req TgSendVideoFileRequest) (msg *tg.Message, err error) {
+	fields := map[string]string{
+		"chat_id":            req.ChatId,
+		"width":              strconv.Itoa(req.Width),
+		"height":             strconv.Itoa(req.Height),
+		"duration":           strconv.Itoa(int(req.Duration.Seconds())),
+		"supports_streaming": "true",
+	}
+	files := []TgApiFile{{Field: "video", Name: filepath.Base(req.FileName), Reader: req.Video}}
+	if req.Thumbnail != nil {
+		files = append(files, TgApiFile{Field: "thumbnail", Name: "thumbnail.jpg", Reader: req.Thumbnail})
+	}
+
+	msg = &tg.Message{}
+	if err := TgApiPostMultipart("sendVideo", fields, files, msg); err != nil {
+		return nil, err
+	}
+	if msg.Video.FileId == "" {
+		return nil, fmt.Errorf("sendVideo Video.FileId empty")
+	}
+	return msg, nil
+}
+
+// TgApiFile is a file field of a multipart bot api request
+type TgApiFile struct {
+	Field  string
+	Name   string
+	Reader io.Reader
+}
+
+// TgApiPostMultipart is TgApiPost uploading files
+func TgApiPostMultipart(method string, fields map[string]string, files []TgApiFile, result interface{}) error {
+	piper, pipew := io.Pipe()
+	mpartw := multipart.NewWriter(pipew)
+
+	go func() {
+		for k, v := range fields {
+			if err := mpartw.WriteField(k, v); err != nil {
+				pipew.CloseWithError(fmt.Errorf("WriteField %s %v", k, err))
+				return
+			}
+		}
+		for _, f := range files {
+			formw, err := mpartw.CreateFormFile(f.Field, f.Name)
+			if err != nil {
+				pipew.CloseWithError(fmt.Errorf("CreateFormFile %s %v", f.Field, err))
+				return
+			}
+			if _, err := io.Copy(formw, f.Reader); err != nil {
+				pipew.CloseWithError(fmt.Errorf("Copy %s %v", f.Field, err))
+				return
+			}
+		}
+		pipew.CloseWithError(mpartw.Close())
+	}()
+
+	resp, err := tg.HttpClient.Post(
+		F("%s/bot%s/%s", tg.ApiUrl, tg.ApiToken, method),
+		mpartw.FormDataContentType(),
+		piper,
+	)
+	piper.Close()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return TgApiDecode(method, resp.Body, result)
+}
+
+type TgGetUpdatesRequest struct {
+	// https://core.telegram.org/bots/api#getupdates
+	Offset  int64 `json:"offset"`
+	Timeout int64 `json:"timeout"`
+}
+
+// TgApiPost calls the bot api method the tg package does not have and decodes the response result into result
+func TgApiPost(method string, req interface{}, result interface{}) error {
+	reqjson, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := tg.HttpClient.Post(
+		F("%s/bot%s/%s", tg.ApiUrl, tg.ApiToken, method),
+		"application/json",
+		bytes.NewBuffer(reqjson),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return TgApiDecode(method, resp.Body, result)
+}
+
+// TgApiDecode decodes the bot api response body result into result
+func TgApiDecode(method string, body io.Reader, result interface{}) error {
+	var tgresp struct {
+		Ok          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(body).Decode(&tgresp); err != nil {
+		return fmt.Errorf("%s json.Decode %v", method, err)
+	}
+	if !tgresp.Ok {
+		return fmt.Errorf("%s %s", method, tgresp.Description)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(tgresp.Result, result); err != nil {
+			return fmt.Errorf("%s json.Unmarshal result %v", method, err)
+		}
+	}
+
+	return nil
+}
+
+// TgGetUpdatesOffset is tg.GetUpdates returning callback queries too and long polling
+func TgGetUpdatesOffset(offset int64) (uu []TgUpdate, err error) {
+	err = TgApiPost("getUpdates", TgGetUpdatesRequest{Offset: offset, Timeout: TgGetUpdatesTimeout}, &uu)
+	return uu, err
+}
+
+// ytVideoFile makes the mp4 file of the video not higher than the channel TgVideoHeightMax
+// and not bigger than TgFileSizeMaxMb: the best video only format muxed with the audio file by ffmpeg
+// or the best progressive format without ffmpeg, transcoded to a lower bitrate if it is too big
+func ytVideoFile(job *TgTubeChanJob, channel *TgTubeChanChannel, vinfo *ytdl.Video, audioFile, name string) (file string, width, height int, err error) {
+	config := &job.Config
+
+	heightmax := channel.TgVideoHeightMax
+	if heightmax <= 0 {
+		heightmax = TgVideoHeightMaxDefault
+	}
+
+	mux := config.FfmpegPath != ""
+
+	var format ytdl.Format
+	for _, f := range vinfo.Formats {
+		// telegram clients stream h264 in mp4
+		if !strings.HasPrefix(f.MimeType, "video/mp4") || !strings.Contains(f.MimeType, "avc1") {
+			continue
+		}
+		if f.Height == 0 || f.Height > heightmax || mux != (f.AudioChannels == 0) {
+			continue
+		}
+		if f.Height > format.Height || f.Height == format.Height && f.Bitrate > format.Bitrate {
+			format = f
+		}
+	}
+	if format.ItagNo == 0 {
+		return "", 0, 0, fmt.Errorf("no video/mp4 avc1 format not higher than <%dp> mux <%t>", heightmax, mux)
+	}
+	perr(F("DEBUG video format itag <%d> [%s] res <%dx%d> size <%dmb>", format.ItagNo, format.MimeType, format.Width, format.Height, format.ContentLength>>20))
+
+	file = fmt.Sprintf("%s..%dp..mp4", name, format.Height)
+	if _, err := ytDownload(job, vinfo, &format, file); err != nil {
+		return "", 0, 0, err
+	}
+
+	if mux {
+		muxfile := fmt.Sprintf("%s..%dp..mux..mp4", name, format.Height)
+		ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions),
+			"-i", file,
+			"-i", audioFile,
+			"-map", "0:v:0", "-map", "1:a:0",
+			"-c:v", "copy",
+		)
+		// opus and mp3 in mp4 do not play everywhere
+		if filepath.Ext(audioFile) == ".m4a" {
+			ffmpegArgs = append(ffmpegArgs, "-c:a", "copy")
+		} else {
+			ffmpegArgs = append(ffmpegArgs, "-c:a", "aac", "-b:a", fmt.Sprintf("%dk", config.TgAudioBitrateKbps))
+		}
+		ffmpegArgs = append(ffmpegArgs,
+			"-movflags", "+faststart",
+			muxfile,
+		)
+		err := ffmpegRun(config, ffmpegArgs)
+		os.Remove(file)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		file = muxfile
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("Stat [%s] %v", file, err)
+	}
+	sizemax := config.TgFileSizeMaxMb << 20
+	if fi.Size() <= sizemax {
+		return file, format.Width, format.Height, nil
+	}
+
+	if config.FfmpegPath == "" || vinfo.Duration < time.Second {
+		os.Remove(file)
+		return "", 0, 0, fmt.Errorf("video size <%dmb> more than TgFileSizeMaxMb <%d>", fi.Size()>>20, config.TgFileSizeMaxMb)
+	}
+
+	// the bitrate to fit with a margin for the container
+	audiokbps := int64(64)
+	videokbps := sizemax*8/1000*95/100/int64(vinfo.Duration.Seconds()) - audiokbps
+	if videokbps < 100 {
+		os.Remove(file)
+		return "", 0, 0, fmt.Errorf("video duration <%v> too long to fit TgFileSizeMaxMb <%d>", vinfo.Duration, config.TgFileSizeMaxMb)
+	}
+	perr(F("DEBUG video size <%dmb> transcoding to bitrate <%dkbps>", fi.Size()>>20, videokbps))
+
+	fitfile := fmt.Sprintf("%s..%dp..%dk..mp4", name, format.Height, videokbps)
+	ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions),
+		"-i", file,
+		"-c:v", "libx264", "-preset", "veryfast",
+		"-b:v", fmt.Sprintf("%dk", videokbps),
+		"-maxrate", fmt.Sprintf("%dk", videokbps),
+		"-bufsize", fmt.Sprintf("%dk", 2*videokbps),
+		"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", audiokbps),
+		"-movflags", "+faststart",
+		fitfile,
+	)
+	err = ffmpegRun(config, ffmpegArgs)
+	os.Remove(file)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	return fitfile, format.Width, format.Height, nil
+}
+
+// AudioPart is a piece of an audio file cut to fit TgFileSizeMaxMb or a chapter
+type AudioPart struct {
+	File     string
+	Start    time.Duration
+	Duration time.Duration
+
+	// of a chapter
+	Title     string
+	Performer string
+}
+
+// Chapter is a part of the video listed with its start timestamp in the description
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
+
+	// of a [Performer - Title] line
+	Performer string
+}
+
+var (
+	// [0:00 Title] [(1:02:03) - Title] [[12:34] Title]
+	ChapterLineRe = regexp.MustCompile(`^[\s\pP]*?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*[-–—|:.]?\s*(.+)$`)
+	// [Title 0:00] [Title - 1:02:03]
+	ChapterLineEndRe = regexp.MustCompile(`^(.+?)\s*[-–—|:]?\s*[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?$`)
+)
+
+// ytChapters parses the description timestamps list the way youtube does:
+// at least three lines with ascending timestamps starting at 0:00 and less than duration
+func ytChapters(description string, duration time.Duration) (chapters []Chapter) {
+	for _, line := range strings.Split(description, NL) {
+		line = strings.TrimSpace(line)
+		var ts, title string
+		if m := ChapterLineRe.FindStringSubmatch(line); m != nil {
+			ts, title = m[1], m[2]
+		} else if m := ChapterLineEndRe.FindStringSubmatch(line); m != nil {
+			ts, title = m[2], m[1]
+		} else {
+			continue
+		}
+
+		var start time.Duration
+		for _, n := range strings.Split(ts, ":") {
+			i, _ := strconv.Atoi(n)
+			start = start*60 + time.Duration(i)*time.Second
+		}
+
+		title = strings.TrimSpace(title)
+		if title == "" {
+			continue
+		}
+
+		if len(chapters) == 0 && start != 0 {
+			return nil
+		}
+		if len(chapters) > 0 && start <= chapters[len(chapters)-1].Start {
+			return nil
+		}
+		if duration > 0 && start >= duration {
+			break
+		}
+
+		chapter := Chapter{Start: start, Title: title}
+		for _, sep := range []string{" - ", " – ", " — "} {
+			if performer, t, ok := strings.Cut(title, sep); ok {
+				chapter.Performer, chapter.Title = strings.TrimSpace(performer), strings.TrimSpace(t)
+				break
+			}
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	if len(chapters) < 3 {
+		return nil
+	}
+
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		} else {
+			chapters[i].End = duration
+		}
+	}
+
+	return chapters
+}
+
+// FullTitle is the chapter title as it is in the description
+func (chapter Chapter) FullTitle() string {
+	if chapter.Performer != "" {
+		return chapter.Performer + " - " + chapter.Title
+	}
+	return chapter.Title
+}
+
+// TgTubeChanCaption is the data of the captions and description templates
+type TgTubeChanCaption struct {
+	Title       string
+	CleanTitle  string // by TgTitleCleanRe and TgTitleUnquote
+	Description string
+	Performer   string
+	Duration    time.Duration
+	Views       int
+	PublishedAt time.Time // in Config.TgTimezone
+	VideoId     string
+	Url         string
+
+	// the audio part or chapter of Parts starting at 1
+	Part      int
+	Parts     int
+	PartTitle string // of a chapter post
+	Chapters  string // the chapters of the part, cut to fit the caption
+
+	// the description message piece
+	Text string
+
+	job  *TgTubeChanJob
+	tags *TgTubeChanCaptionTags
+}
+
+// TgTubeChanCaptionTags are the video tags got once for all the copies of the caption data
+type TgTubeChanCaptionTags struct {
+	sync.Once
+	Tags []string
+}
+
+const (
+	TgPhotoCaptionTemplateDefault = `{{ boldunderline (esc .CleanTitle) }}`
+	TgAudioCaptionTemplateDefault = `{{ if .PartTitle }}{{ esc (printf "%d/%d %s" .Part .Parts .PartTitle) }}
+{{ end }}{{ esc .CleanTitle }}
+{{ esc .Performer }} {{ esc (.PublishedAt.Format "2006/01/02") }}
+{{ esc (printf "youtu.be/%s %s" .VideoId .Duration) }}
+{{- if and (not .PartTitle) (gt .Parts 1) }}
+{{ esc (printf "part %d/%d" .Part .Parts) }}{{ end }}
+{{- if .Chapters }}
+
+{{ esc .Chapters }}{{ end }}`
+	TgDescriptionTemplateDefault = `{{ esc .Text }}`
+)
+
+// Tags gets the youtube video tags when a template uses them
+func (caption *TgTubeChanCaption) Tags() []string {
+	if caption.tags == nil || caption.job == nil {
+		return nil
+	}
+	caption.tags.Do(func() {
+		if videos, err := ytVideosList(caption.job, []string{caption.VideoId}); err != nil {
+			perr(F("ERROR ytVideosList %v", err))
+		} else if len(videos) > 0 {
+			caption.tags.Tags = videos[0].Snippet.Tags
+		}
+	})
+	return caption.tags.Tags
+}
+
+// CaptionTemplateFuncs are the template helpers, the values are escaped by esc unless formatted by the others
+var CaptionTemplateFuncs = template.FuncMap{
+	"esc":           tg.Esc,
+	"bold":          tg.Bold,
+	"italic":        tg.Italic,
+	"underline":     tg.Underline,
+	"boldunderline": tg.BoldUnderline,
+	"code":          tg.Code,
+	"link":          tg.Link,
+	"join":          strings.Join,
+	"timestamp":     fmtTimestamp,
+	// trunc cuts the text to size characters ending with …
+	"trunc": func(size int, text string) string {
+		if r := []rune(text); len(r) > size {
+			if size < 1 {
+				return ""
+			}
+			return string(r[:size-1]) + "…"
+		}
+		return text
+	},
+}
+
+// captionTemplate parses the template text, the default text when it is empty
+func captionTemplate(text, textDefault string) (*template.Template, error) {
+	if text == "" {
+		text = textDefault
+	}
+	tmpl, err := template.New("").Funcs(CaptionTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template [%s] %v", text, err)
+	}
+	return tmpl, nil
+}
+
+// captionRender executes the template cutting the chapters, the description, the text and the titles in turn until it fits size characters
+func captionRender(tmpl *template.Template, data TgTubeChanCaption, size int) (string, error) {
+	render := func() (string, error) {
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, &data); err != nil {
+			return "", fmt.Errorf("template %v", err)
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+
+	text, err := render()
+	if err != nil {
+		return "", err
+	}
+	for _, field := range []*string{&data.Chapters, &data.Description, &data.Text, &data.PartTitle, &data.CleanTitle, &data.Title} {
+		// the field not in the template or cut by trunc in it does not change the text and is halved
+		halve := false
+		for *field != "" && tgTextLen(text) > size {
+			textlen := tgTextLen(text)
+			r := []rune(*field)
+			cut := len(r) - (textlen - size) - 1
+			if halve {
+				cut = min(cut, len(r)/2, len(r)-2)
+			}
+			if cut > 0 {
+				*field = string(r[:cut]) + "…"
+			} else {
+				*field = ""
+			}
+			if text, err = render(); err != nil {
+				return "", err
+			}
+			halve = tgTextLen(text) == textlen
+		}
+	}
+	if tgTextLen(text) > size {
+		return "", fmt.Errorf("template text size <%d> more than <%d>", tgTextLen(text), size)
+	}
+	return text, nil
+}
+
+// tgTextLen is the number of characters of the MarkdownV2 text without the escapes
+func tgTextLen(text string) (n int) {
+	escaped := false
+	for _, c := range text {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		n++
+	}
+	return n
+}
+
+// chaptersCaption lists the chapters between start and end with the timestamps from start
+func chaptersCaption(chapters []Chapter, start, end time.Duration) string {
+	var ll []string
+	for _, c := range chapters {
+		if c.Start < start || c.Start >= end {
+			continue
+		}
+		ll = append(ll, fmtTimestamp(c.Start-start)+" "+c.FullTitle())
+	}
+	return strings.Join(ll, NL)
+}
 
-				if chatfullinfo.Photo.BigFileId == "" {
-					tglog(F("gonna set photo for chat [%s]", mcm.Chat.Title))
-				}
+// fmtTimestamp formats the duration as [1:02:03] or [2:03]
+func fmtTimestamp(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	h, m, sec := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
 
-			} else if mcm.NewChatMember.Status == "left" {
+// ffmetadataEsc escapes the ffmetadata special characters
+func ffmetadataEsc(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, `;`, `\;`, `#`, `\#`, NL, `\`+NL).Replace(s)
+}
 
-				for i := range Config.Channels {
-					if Config.Channels[i].TgChatId == tg.F("%d", mcm.Chat.Id) {
-						Config.Channels[i].Suspend = true
-						perr(F("channel @YtUsername [%s] @Suspend <%t>", Config.Channels[i].YtUsername, Config.Channels[i].Suspend))
-						if err := Config.Put(); err != nil {
-							return fmt.Errorf("Config.Put %v", err)
-						}
-					}
-				}
+// AudioTags are the metadata tags written into the audio files
+type AudioTags struct {
+	Title   string
+	Artist  string
+	Album   string
+	Date    string
+	Comment string
+}
 
-			}
+// flacPictureBlock is the base64 flac picture metadata block as in the vorbis comment METADATA_BLOCK_PICTURE
+// https://www.xiph.org/flac/format.html#metadata_block_picture
+func flacPictureBlock(picture []byte, width, height int) string {
+	mime := http.DetectContentType(picture)
+	b := new(bytes.Buffer)
+	// front cover
+	binary.Write(b, binary.BigEndian, uint32(3))
+	binary.Write(b, binary.BigEndian, uint32(len(mime)))
+	b.WriteString(mime)
+	// description
+	binary.Write(b, binary.BigEndian, uint32(0))
+	binary.Write(b, binary.BigEndian, uint32(width))
+	binary.Write(b, binary.BigEndian, uint32(height))
+	// color depth and indexed colors
+	binary.Write(b, binary.BigEndian, uint32(24))
+	binary.Write(b, binary.BigEndian, uint32(0))
+	binary.Write(b, binary.BigEndian, uint32(len(picture)))
+	b.Write(picture)
+	return base64.StdEncoding.EncodeToString(b.Bytes())
+}
+
+// audioMetadataEmbed writes the tags, the cover and the chapters into the audio file, returns the new file replacing file
+func audioMetadataEmbed(config *TgTubeChanConfig, file string, tags AudioTags, cover []byte, coverWidth, coverHeight int, chapters []Chapter) (metadataEmbedFile string, err error) {
+	ext := filepath.Ext(file)
+
+	metadata := ";FFMETADATA1" + NL
+	for _, tag := range [][2]string{
+		{"title", tags.Title},
+		{"artist", tags.Artist},
+		{"album", tags.Album},
+		{"date", tags.Date},
+		{"comment", tags.Comment},
+	} {
+		if tag[1] != "" {
+			metadata += tag[0] + "=" + ffmetadataEsc(tag[1]) + NL
+		}
+	}
+	// ogg has no attached pictures streams
+	if ext == ".ogg" && len(cover) > 0 {
+		metadata += "METADATA_BLOCK_PICTURE=" + ffmetadataEsc(flacPictureBlock(cover, coverWidth, coverHeight)) + NL
+	}
+	for _, c := range chapters {
+		metadata += "[CHAPTER]" + NL +
+			"TIMEBASE=1/1000" + NL +
+			F("START=%d", c.Start.Milliseconds()) + NL +
+			F("END=%d", c.End.Milliseconds()) + NL +
+			"title=" + ffmetadataEsc(c.FullTitle()) + NL
+	}
+	metadataFile := file + "..metadata.txt"
+	if err := os.WriteFile(metadataFile, []byte(metadata), 0600); err != nil {
+		return "", fmt.Errorf("WriteFile [%s] %v", metadataFile, err)
+	}
+	defer os.Remove(metadataFile)
 
+	metadataEmbedFile = strings.TrimSuffix(file, ext) + "..metadata" + ext
+	ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions),
+		"-i", file,
+		"-f", "ffmetadata", "-i", metadataFile,
+	)
+	if ext != ".ogg" && len(cover) > 0 {
+		coverFile := file + "..cover"
+		if err := os.WriteFile(coverFile, cover, 0600); err != nil {
+			return "", fmt.Errorf("WriteFile [%s] %v", coverFile, err)
 		}
+		defer os.Remove(coverFile)
+		ffmpegArgs = append(ffmpegArgs,
+			"-i", coverFile,
+			"-map", "0:a", "-map", "2:v",
+			"-disposition:v:0", "attached_pic",
+		)
+	} else {
+		ffmpegArgs = append(ffmpegArgs, "-map", "0:a")
+	}
+	if ext == ".mp3" {
+		ffmpegArgs = append(ffmpegArgs, "-id3v2_version", "3")
+	}
+	ffmpegArgs = append(ffmpegArgs,
+		"-map_metadata", "1",
+		"-map_chapters", "1",
+		"-c", "copy",
+		metadataEmbedFile,
+	)
+	if err := ffmpegRun(config, ffmpegArgs); err != nil {
+		os.Remove(metadataEmbedFile)
+		return "", err
 	}
 
-	return nil
+	if err := os.Remove(file); err != nil {
+		perr(F("ERROR Remove [%s] %v", file, err))
+	}
 
+	return metadataEmbedFile, nil
 }
 
-func processYtChannel(channel *TgTubeChanChannel) (err error) {
-	if channel.YtPlaylistId == "" {
-		if channel.YtUsername == "" && channel.YtChannelId == "" {
-			return fmt.Errorf("both YtUsername and YtChannelId empty")
+// audioChapterParts cuts the audio file into the chapters, and the chapters larger than TgFileSizeMaxMb into parts
+func audioChapterParts(config *TgTubeChanConfig, file string, chapters []Chapter) (parts []AudioPart, err error) {
+	ext := filepath.Ext(file)
+	for i, c := range chapters {
+		part := AudioPart{
+			File:      fmt.Sprintf("%s..chapter%d%s", strings.TrimSuffix(file, ext), i+1, ext),
+			Start:     c.Start,
+			Duration:  c.End - c.Start,
+			Title:     c.Title,
+			Performer: c.Performer,
+		}
+		ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions),
+			"-i", file,
+			"-ss", F("%.3f", part.Start.Seconds()),
+			"-t", F("%.3f", part.Duration.Seconds()),
+			"-map", "0:a", "-map", "0:v?",
+			"-map_chapters", "-1",
+			"-metadata", "title="+c.Title,
+		)
+		if c.Performer != "" {
+			ffmpegArgs = append(ffmpegArgs, "-metadata", "artist="+c.Performer)
+		}
+		ffmpegArgs = append(ffmpegArgs,
+			"-c", "copy",
+			part.File,
+		)
+		if err := ffmpegRun(config, ffmpegArgs); err != nil {
+			for _, p := range parts {
+				os.Remove(p.File)
+			}
+			return nil, err
 		}
 
-		// https://developers.google.com/youtube/v3/docs/channels/list
+		// a chapter larger than TgFileSizeMaxMb is split by size
+		subparts, err := audioSplit(config, part.File, part.Duration, nil)
+		if err != nil {
+			os.Remove(part.File)
+			for _, p := range parts {
+				os.Remove(p.File)
+			}
+			return nil, err
+		}
+		if len(subparts) == 1 {
+			parts = append(parts, part)
+			continue
+		}
+		os.Remove(part.File)
+		for j, subpart := range subparts {
+			subpart.Start += part.Start
+			subpart.Title = part.Title + F(" part %d/%d", j+1, len(subparts))
+			subpart.Performer = part.Performer
+			parts = append(parts, subpart)
+		}
+	}
+	return parts, nil
+}
 
-		channelslistcall := YtSvc.Channels.List([]string{"id", "snippet", "contentDetails"}).MaxResults(11)
-		if channel.YtChannelId != "" {
-			channelslistcall = channelslistcall.Id(channel.YtChannelId)
-		} else if channel.YtUsername != "" {
-			// https://developers.google.com/youtube/v3/docs/channels/list#forHandle
-			channelslistcall = channelslistcall.ForHandle(channel.YtUsername)
+// audioSplit cuts the audio file bigger than TgFileSizeMaxMb into parts of about the same duration,
+// the cuts are moved to the nearest of the prefer points or silences,
+// the file itself is the only part when it fits and the parts still too big are split again
+func audioSplit(config *TgTubeChanConfig, file string, duration time.Duration, prefer []time.Duration) (parts []AudioPart, err error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("Stat [%s] %v", file, err)
+	}
+	sizemax := config.TgFileSizeMaxMb << 20
+	if fi.Size() <= sizemax {
+		return []AudioPart{{File: file, Duration: duration}}, nil
+	}
+	if config.FfmpegPath == "" {
+		return nil, fmt.Errorf("audio size <%dmb> more than TgFileSizeMaxMb <%d> and FfmpegPath empty", fi.Size()>>20, config.TgFileSizeMaxMb)
+	}
+
+	// parts with a margin for the bitrate variations
+	n := int(fi.Size()/(sizemax*9/10)) + 1
+	partmax := time.Duration(float64(duration) * float64(sizemax*9/10) / float64(fi.Size()))
+	perr(F("DEBUG audio size <%dmb> splitting into <%d> parts not longer than <%v>", fi.Size()>>20, n, partmax.Truncate(time.Second)))
+
+	if len(prefer) == 0 {
+		if prefer, err = ffmpegSilences(config, file); err != nil {
+			perr(F("ERROR ffmpegSilences %v", err))
 		}
-		channelslist, err := channelslistcall.Do()
-		if err != nil {
-			return fmt.Errorf("channels/list %v", err)
+	}
+
+	cuts := audioCuts(duration, n, partmax, prefer)
+
+	cleanup := func() {
+		for _, p := range parts {
+			os.Remove(p.File)
 		}
+	}
 
-		if len(channelslist.Items) == 0 {
-			return fmt.Errorf("channels/list empty result")
+	ext := filepath.Ext(file)
+	for i := range n {
+		part := AudioPart{
+			File:  fmt.Sprintf("%s..part%d%s", strings.TrimSuffix(file, ext), i+1, ext),
+			Start: cuts[i],
+		}
+		part.Duration = cuts[i+1] - cuts[i]
+		ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions),
+			"-i", file,
+			"-ss", F("%.3f", part.Start.Seconds()),
+			"-t", F("%.3f", part.Duration.Seconds()),
+			"-map", "0:a", "-map", "0:v?",
+			"-c", "copy",
+			part.File,
+		)
+		if err := ffmpegRun(config, ffmpegArgs); err != nil {
+			cleanup()
+			return nil, err
 		}
 
-		for _, c := range channelslist.Items {
-			tglog(F(
-				"DEBUG %s channel id [%s] title [%s] uploads playlist id <%v>",
-				channel.YtUsername, c.Id, c.Snippet.Title, c.ContentDetails.RelatedPlaylists.Uploads,
-			))
+		pi, err := os.Stat(part.File)
+		if err != nil {
+			os.Remove(part.File)
+			cleanup()
+			return nil, fmt.Errorf("Stat [%s] %v", part.File, err)
 		}
-		if len(channelslist.Items) > 1 {
-			return fmt.Errorf("channels/list more than one result")
+		if pi.Size() <= sizemax {
+			parts = append(parts, part)
+			continue
 		}
 
-		if channel.YtChannelId == "" {
-			channel.YtChannelId = channelslist.Items[0].Id
+		// the bitrate of the part is above the average
+		perr(F("DEBUG audio part <%d> size <%dmb> more than TgFileSizeMaxMb <%d> splitting again", i+1, pi.Size()>>20, config.TgFileSizeMaxMb))
+		var partprefer []time.Duration
+		for _, p := range prefer {
+			if p > part.Start && p < part.Start+part.Duration {
+				partprefer = append(partprefer, p-part.Start)
+			}
+		}
+		subparts, err := audioSplit(config, part.File, part.Duration, partprefer)
+		os.Remove(part.File)
+		if err != nil {
+			cleanup()
+			return nil, err
 		}
-		channel.YtPlaylistId = channelslist.Items[0].ContentDetails.RelatedPlaylists.Uploads
-		if err := Config.Put(); err != nil {
-			return fmt.Errorf("Config.Put %v", err)
+		for _, subpart := range subparts {
+			subpart.Start += part.Start
+			parts = append(parts, subpart)
 		}
 	}
 
-	var videos []youtube.PlaylistItemSnippet
+	return parts, nil
+}
 
-	// https://developers.google.com/youtube/v3/docs/playlistItems/list
-	playlistitemslistcall := YtSvc.PlaylistItems.List([]string{"id", "snippet", "contentDetails"}).MaxResults(Config.YtMaxResults)
-	playlistitemslistcall = playlistitemslistcall.PlaylistId(channel.YtPlaylistId)
-	// TODO request results sorted by date asc
-	if err = playlistitemslistcall.Pages(
-		Ctx,
-		func(resp *youtube.PlaylistItemListResponse) error {
-			for _, item := range resp.Items {
-				//log("DEBUG %s playlistitem %02d %s", channel.YtUsername, jitem+1, item.Snippet.PublishedAt)
-				// item.Snippet.PublishedAt channel.YtLast are strings
-				// playlistitems/list results are sorted by date desc
-				// stop Pages after receiving an item older than YtLast
-				if channel.YtLast != "" && item.Snippet.PublishedAt <= channel.YtLast {
-					return ENUFF
-				}
-				videos = append(videos, *item.Snippet)
+// audioCuts returns the n+1 boundaries of n parts of the duration,
+// every cut is moved to the nearest prefer point within a quarter of the part duration
+// as long as no part gets longer than partmax, which is at least duration/n
+func audioCuts(duration time.Duration, n int, partmax time.Duration, prefer []time.Duration) (cuts []time.Duration) {
+	partduration := duration / time.Duration(n)
+	partmax = max(partmax, partduration)
+	cuts = append(cuts, 0)
+	for i := 1; i < n; i++ {
+		prev := cuts[len(cuts)-1]
+		// the cut range leaving the rest parts not longer than partmax
+		lo, hi := max(prev, duration-partmax*time.Duration(n-i)), min(prev+partmax, duration)
+		cut := min(max(partduration*time.Duration(i), lo), hi)
+		best, bestd := cut, partduration/4
+		for _, p := range prefer {
+			if p <= prev || p < lo || p > hi || p >= duration {
+				continue
 			}
-			return nil
-		},
-	); err != nil && err != ENUFF {
-		return fmt.Errorf("playlistitems/list %v", err)
+			if d := (p - cut).Abs(); d < bestd {
+				best, bestd = p, d
+			}
+		}
+		cuts = append(cuts, best)
 	}
+	return append(cuts, duration)
+}
 
-	sort.Slice(videos, func(i, j int) bool { return videos[i].PublishedAt < videos[j].PublishedAt })
+// ffmpegSilencesRe matches the silencedetect log lines
+var ffmpegSilencesRe = regexp.MustCompile(`silence_(start|end): (-?[0-9.]+)`)
 
-	YtdlCl = ytdl.Client{
-		HTTPClient: &http.Client{
-			Transport: &UserAgentTransport{
-				http.DefaultTransport,
-				Config.YtUserAgent,
-			},
-		},
-	}
+// ffmpegSilences returns the middles of the silences in the file
+func ffmpegSilences(config *TgTubeChanConfig, file string) (silences []time.Duration, err error) {
+	FfmpegRuns <- struct{}{}
+	defer func() { <-FfmpegRuns }()
 
-	for j, v := range videos {
-		perr(F(
-			"DEBUG %s <%d>/<%d> title [%s] url [youtu.be/%s] published <%s>",
-			channel.YtUsername, j+1, len(videos), v.Title, v.ResourceId.VideoId, v.PublishedAt,
-		))
+	ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions),
+		"-v", "info", "-nostats",
+		"-i", file,
+		"-af", "silencedetect=noise=-35dB:d=0.7",
+		"-f", "null", "-",
+	)
+	out, err := exec.Command(config.FfmpegPath, ffmpegArgs...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg (%s %v) %v", config.FfmpegPath, ffmpegArgs, err)
+	}
 
-		vpatime, err := time.Parse(time.RFC3339, v.PublishedAt)
+	var start float64
+	for _, m := range ffmpegSilencesRe.FindAllStringSubmatch(string(out), -1) {
+		t, err := strconv.ParseFloat(m[2], 64)
 		if err != nil {
-			return fmt.Errorf("time.Parse PublishedAt [%s] %v", v.PublishedAt, err)
+			continue
+		}
+		if m[1] == "start" {
+			start = max(t, 0)
+			continue
 		}
+		silences = append(silences, time.Duration((start+t)/2*float64(time.Second)))
+	}
 
-		vinfo, err := YtdlCl.GetVideoContext(Ctx, v.ResourceId.VideoId)
-		if err != nil {
+	return silences, nil
+}
 
-			if _, ok := err.(*ytdl.ErrPlayabiltyStatus); ok {
+// FfmpegLoudnormMeasured is the loudnorm print_format=json output of the first pass
+type FfmpegLoudnormMeasured struct {
+	InputI       string `json:"input_i"`
+	InputTp      string `json:"input_tp"`
+	InputLra     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
 
-				// cannot playback and download, status: LIVE_STREAM_OFFLINE, reason: This live event will begin in a few moments.
-				if err.(*ytdl.ErrPlayabiltyStatus).Status == "LIVE_STREAM_OFFLINE" && time.Now().Sub(vpatime) > 24*time.Hour {
-					perr(F("DEBUG GetVideoContext skipping LIVE_STREAM_OFFLINE youtu.be/%s", v.ResourceId.VideoId))
-					continue
-				}
+// ffmpegLoudnorm measures the file loudness and returns the second pass loudnorm filter to lufs
+func ffmpegLoudnorm(config *TgTubeChanConfig, file string, lufs float64) (filter string, err error) {
+	FfmpegRuns <- struct{}{}
+	defer func() { <-FfmpegRuns }()
+
+	target := F("I=%v:TP=%v:LRA=%v", lufs, LoudnormTruePeak, LoudnormRange)
+	ffmpegArgs := append(slices.Clone(config.FfmpegGlobalOptions),
+		"-v", "info", "-nostats",
+		"-i", file,
+		"-map", "0:a",
+		"-af", "loudnorm="+target+":print_format=json",
+		"-f", "null", "-",
+	)
+	out, err := exec.Command(config.FfmpegPath, ffmpegArgs...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg (%s %v) %v", config.FfmpegPath, ffmpegArgs, err)
+	}
 
-				// youtu.be/6L37mxTMxcQ Video unavailable. This video contains content from Beggars Group Digital, who has blocked it in your country on copyright grounds.
-				if err.(*ytdl.ErrPlayabiltyStatus).Status == "UNPLAYABLE" {
-					tgmsg := tg.Italic("UNPLAYABLE") + NL +
-						tg.Esc(tg.F(
-							"%s"+NL+"%s %s"+NL+"youtu.be/%s",
-							v.Title, channel.TgPerformer, vpatime.Format("2006/01/02"), v.ResourceId.VideoId,
-						))
-					if _, tgerr := tg.SendMessage(tg.SendMessageRequest{
-						ChatId: channel.TgChatId,
-						Text:   tgmsg,
-
-						LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
-					}); tgerr != nil {
-						return fmt.Errorf("tg.SendMessage %v", tgerr)
-					}
+	// the json is the last thing printed
+	i, j := bytes.LastIndexByte(out, '{'), bytes.LastIndexByte(out, '}')
+	if i < 0 || j < i {
+		return "", fmt.Errorf("loudnorm json not found")
+	}
+	var measured FfmpegLoudnormMeasured
+	if err := json.Unmarshal(out[i:j+1], &measured); err != nil {
+		return "", fmt.Errorf("loudnorm json %v", err)
+	}
+	for _, v := range []string{measured.InputI, measured.InputTp, measured.InputLra, measured.InputThresh, measured.TargetOffset} {
+		// silence measures as -inf
+		if f, err := strconv.ParseFloat(v, 64); err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", fmt.Errorf("loudnorm measured [%s] invalid", v)
+		}
+	}
+	perr(F("DEBUG loudnorm measured %+v", measured))
 
-					channel.YtLast = vpatime.Format(time.RFC3339)
-					if err := Config.Put(); err != nil {
-						perr(F("Config.Put %v", err))
-					}
+	return F(
+		"loudnorm=%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		target, measured.InputI, measured.InputTp, measured.InputLra, measured.InputThresh, measured.TargetOffset,
+	), nil
+}
 
-					continue
-				}
+// ytDownload saves the format stream of the video to the file, waiting for a free Downloads slot
+func ytDownload(job *TgTubeChanJob, vinfo *ytdl.Video, format *ytdl.Format, file string) (written int64, err error) {
+	Downloads <- struct{}{}
+	defer func() { <-Downloads }()
 
-			}
+	ytstream, _, err := job.YtdlCl.GetStreamContext(Ctx, vinfo, format)
+	if err != nil {
+		return 0, fmt.Errorf("GetStreamContext %v", err)
+	}
+	defer ytstream.Close()
 
-			// can't bypass age restriction: embedding of this video has been disabled
-			if err2 := errors.Unwrap(err); err2 != nil && err2.Error() == MsgEmbeddingDisabled {
-				tgmsg := tg.Italic(MsgEmbeddingDisabled) + NL +
-					tg.Esc(tg.F(
-						"%s"+NL+"%s %s"+NL+"youtu.be/%s",
-						v.Title, channel.TgPerformer, vpatime.Format("2006/01/02"), v.ResourceId.VideoId,
-					))
-				if _, tgerr := tg.SendMessage(tg.SendMessageRequest{
-					ChatId: channel.TgChatId,
-					Text:   tgmsg,
+	ytstreamthrottled := &ThrottledReader{Reader: ytstream, Bps: int64(format.Bitrate) * job.Config.YtThrottle}
 
-					LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
-				}); tgerr != nil {
-					return fmt.Errorf("tg.SendMessage %v", tgerr)
-				}
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, fmt.Errorf("Create [%s] %v", file, err)
+	}
 
-				channel.YtLast = vpatime.Format(time.RFC3339)
-				if err := Config.Put(); err != nil {
-					perr(F("Config.Put %v", err))
-				}
+	written, err = io.Copy(f, ytstreamthrottled)
+	if err != nil {
+		f.Close()
+		return 0, fmt.Errorf("copy stream %v", err)
+	}
 
-				continue
-			}
+	if err := f.Close(); err != nil {
+		perr(F("Close [%s] %v", file, err))
+	}
 
-			// login required to confirm your age
-			if err.Error() == MsgLoginRequired {
-				tgmsg := tg.Italic(MsgLoginRequired) + NL +
-					tg.Esc(tg.F(
-						"%s"+NL+"%s %s"+NL+"youtu.be/%s",
-						v.Title, channel.TgPerformer, vpatime.Format("2006/01/02"), v.ResourceId.VideoId,
-					))
-				if _, tgerr := tg.SendMessage(tg.SendMessageRequest{
-					ChatId: channel.TgChatId,
-					Text:   tgmsg,
+	return written, nil
+}
 
-					LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
-				}); tgerr != nil {
-					return fmt.Errorf("tg.SendMessage %v", tgerr)
-				}
+// ffmpegRun runs ffmpeg with the args, waiting for a free FfmpegRuns slot
+func ffmpegRun(config *TgTubeChanConfig, args []string) error {
+	FfmpegRuns <- struct{}{}
+	defer func() { <-FfmpegRuns }()
 
-				channel.YtLast = vpatime.Format(time.RFC3339)
-				if err := Config.Put(); err != nil {
-					perr(F("Config.Put %v", err))
-				}
+	if err := exec.Command(config.FfmpegPath, args...).Run(); err != nil {
+		return fmt.Errorf("ffmpeg (%s %v) %v", config.FfmpegPath, args, err)
+	}
+	return nil
+}
 
-				continue
-			}
+// YtFeed is the youtube channel atom feed
+type YtFeed struct {
+	Entries []YtFeedEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type YtFeedEntry struct {
+	VideoId   string `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+	ChannelId string `xml:"http://www.youtube.com/xml/schemas/2015 channelId"`
+	Title     string `xml:"http://www.w3.org/2005/Atom title"`
+	Author    string `xml:"http://www.w3.org/2005/Atom author>name"`
+	Published string `xml:"http://www.w3.org/2005/Atom published"`
+
+	Group struct {
+		Description string `xml:"http://search.yahoo.com/mrss/ description"`
+		Thumbnail   struct {
+			Url    string `xml:"url,attr"`
+			Width  int64  `xml:"width,attr"`
+			Height int64  `xml:"height,attr"`
+		} `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	} `xml:"http://search.yahoo.com/mrss/ group"`
+}
 
-			return fmt.Errorf("GetVideoContext %#v"+NL+"%#v", err, v)
+// ytFeedParse converts the channel feed entries to playlist items sorted by date desc like playlistitems/list
+func ytFeedParse(data []byte) (items []youtube.PlaylistItemSnippet, err error) {
+	var feed YtFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal %v", err)
+	}
 
+	for _, e := range feed.Entries {
+		if e.VideoId == "" {
+			return nil, fmt.Errorf("entry [%s] without videoId", e.Title)
+		}
+		published, err := time.Parse(time.RFC3339, e.Published)
+		if err != nil {
+			return nil, fmt.Errorf("entry [%s] time.Parse published [%s] %v", e.VideoId, e.Published, err)
 		}
+		item := youtube.PlaylistItemSnippet{
+			ChannelId:    e.ChannelId,
+			ChannelTitle: e.Author,
+			Title:        e.Title,
+			Description:  e.Group.Description,
+			// same format as the data api
+			PublishedAt: published.UTC().Format(time.RFC3339),
+			ResourceId:  &youtube.ResourceId{Kind: "youtube#video", VideoId: e.VideoId},
+			Thumbnails:  &youtube.ThumbnailDetails{},
+		}
+		// the feed has the letterboxed hqdefault only, it is the last resort and ytVideosFill sets the others
+		if e.Group.Thumbnail.Url != "" {
+			item.Thumbnails.Default = &youtube.Thumbnail{
+				Url:    e.Group.Thumbnail.Url,
+				Width:  e.Group.Thumbnail.Width,
+				Height: e.Group.Thumbnail.Height,
+			}
+		}
+		items = append(items, item)
+	}
 
-		vtitle := v.Title
+	sort.SliceStable(items, func(i, j int) bool { return items[i].PublishedAt > items[j].PublishedAt })
 
-		if TgTitleCleanRe != nil {
-			vtitle = TgTitleCleanRe.ReplaceAllString(vtitle, "")
-		}
+	return items, nil
+}
 
-		if channel.TgTitleUnquote {
-			if strings.HasPrefix(vtitle, `"`) && strings.HasSuffix(vtitle, `"`) {
-				vtitle = strings.Trim(vtitle, `"`)
-			}
-			if strings.HasPrefix(vtitle, `«`) && strings.HasSuffix(vtitle, `»`) {
-				vtitle = strings.Trim(vtitle, `«`)
-				vtitle = strings.Trim(vtitle, `»`)
-			}
-			for strings.Contains(vtitle, `"`) {
-				vtitle = strings.Replace(vtitle, `"`, `«`, 1)
-				vtitle = strings.Replace(vtitle, `"`, `»`, 1)
-			}
+// ytFeedGet gets the channel feed
+func ytFeedGet(job *TgTubeChanJob, channelid string) (items []youtube.PlaylistItemSnippet, err error) {
+	if channelid == "" {
+		return nil, fmt.Errorf("channel id empty")
+	}
+
+	resp, err := job.YtdlCl.HTTPClient.Get(YtFeedUrl + "?" + url.Values{"channel_id": {channelid}}.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("response status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ytFeedParse(data)
+}
+
+// ytVideosList gets the videos snippets with videos/list by 50 ids
+func ytVideosList(job *TgTubeChanJob, videoids []string) (videos []*youtube.Video, err error) {
+	for len(videoids) > 0 {
+		n := min(len(videoids), 50)
+		// https://developers.google.com/youtube/v3/docs/videos/list
+		videoslist, err := job.YtSvc.Videos.List([]string{"snippet", "statistics", "status"}).Id(videoids[:n]...).Do()
+		if err != nil {
+			return nil, fmt.Errorf("videos/list %v", err)
 		}
+		videoids = videoids[n:]
+		videos = append(videos, videoslist.Items...)
+	}
+	return videos, nil
+}
 
-		audioName := fmt.Sprintf(
-			"%04d%02d%02d.%02d%02d%02d.%s",
-			vpatime.Year(), vpatime.Month(), vpatime.Day(),
-			vpatime.Hour(), vpatime.Minute(), vpatime.Second(),
-			v.ResourceId.VideoId,
-		)
+// ytVideosFill gets the full descriptions and the thumbnails of the feed items with videos/list
+func ytVideosFill(job *TgTubeChanJob, items []youtube.PlaylistItemSnippet) error {
+	var videoids []string
+	for _, item := range items {
+		videoids = append(videoids, item.ResourceId.VideoId)
+	}
 
-		var audioFormat ytdl.Format
-		for _, f := range vinfo.Formats.WithAudioChannels() {
-			if !strings.HasPrefix(f.MimeType, "audio/mp4") {
-				continue
-			}
-			perr(F("DEBUG format size <%dmb> AudioTrack %+v", f.ContentLength>>20, f.AudioTrack))
-			if f.AudioTrack != nil && !strings.HasSuffix(f.AudioTrack.DisplayName, " original") {
+	videos, err := ytVideosList(job, videoids)
+	if err != nil {
+		return err
+	}
+
+	for _, video := range videos {
+		for i := range items {
+			if items[i].ResourceId.VideoId != video.Id {
 				continue
 			}
-			if audioFormat.Bitrate == 0 || f.Bitrate > audioFormat.Bitrate {
-				perr("DEBUG pick")
-				audioFormat = f
+			items[i].Description = video.Snippet.Description
+			if video.Snippet.Thumbnails != nil {
+				items[i].Thumbnails = video.Snippet.Thumbnails
 			}
 		}
+	}
 
-		var ytstream io.ReadCloser
-		if ytstream, _, err = YtdlCl.GetStreamContext(Ctx, vinfo, &audioFormat); err != nil {
-			return fmt.Errorf("GetStreamContext %v", err)
-		}
-		defer ytstream.Close()
+	return nil
+}
 
-		ytstreamthrottled := &ThrottledReader{Reader: ytstream, Bps: int64(audioFormat.Bitrate) * Config.YtThrottle}
+// ytVideosGet gets the videos as playlist items, the deleted and private videos are missing in the result
+func ytVideosGet(job *TgTubeChanJob, videoids []string) (items []youtube.PlaylistItemSnippet, err error) {
+	videos, err := ytVideosList(job, videoids)
+	if err != nil {
+		return nil, err
+	}
 
-		audioSrcFile := fmt.Sprintf("%s..m4a", audioName)
+	for _, video := range videos {
+		items = append(items, ytVideoSnippet(video))
+	}
 
-		audioSrc, err := os.Create(audioSrcFile)
-		if err != nil {
-			return fmt.Errorf("Create [%s] %v", audioSrcFile, err)
-		}
+	return items, nil
+}
 
-		t0dl := time.Now()
-		copywritten, err := io.Copy(audioSrc, ytstreamthrottled)
-		if err != nil {
-			return fmt.Errorf("copy stream %v", err)
-		}
+// ytVideoSnippet is the video as a playlist item
+func ytVideoSnippet(video *youtube.Video) youtube.PlaylistItemSnippet {
+	return youtube.PlaylistItemSnippet{
+		ChannelId:    video.Snippet.ChannelId,
+		ChannelTitle: video.Snippet.ChannelTitle,
+		Title:        video.Snippet.Title,
+		Description:  video.Snippet.Description,
+		PublishedAt:  video.Snippet.PublishedAt,
+		ResourceId:   &youtube.ResourceId{Kind: "youtube#video", VideoId: video.Id},
+		Thumbnails:   video.Snippet.Thumbnails,
+	}
+}
 
-		err = audioSrc.Close()
-		if err != nil {
-			perr(F("Close [%s] %v", audioSrcFile, err))
-		}
+// ChannelId is the youtube channel id of the channel state, known from channels/list or the uploads playlist id,
+// it is empty for a channel mirroring another playlist so the feed and the hub of its uploads are not used
+func (chstate *TgTubeChanChannelState) ChannelId() string {
+	if chstate.YtPlaylistId != "" && !strings.HasPrefix(chstate.YtPlaylistId, "UU") {
+		return ""
+	}
+	if chstate.YtChannelId != "" {
+		return chstate.YtChannelId
+	}
+	if strings.HasPrefix(chstate.YtPlaylistId, "UU") {
+		// the uploads playlist of channel UCxxx is UUxxx
+		return "UC" + strings.TrimPrefix(chstate.YtPlaylistId, "UU")
+	}
+	return ""
+}
 
-		perr(F(
-			"DEBUG downloaded audio size <%dmb> bitrate <%dkbps> duration <%v> in <%v>",
-			copywritten>>20, audioFormat.Bitrate>>10, vinfo.Duration, time.Now().Sub(t0dl).Truncate(time.Second),
-		))
+// WebSubStart serves the hub callbacks, the subscriptions are requested by WebSubRenew
+func WebSubStart() error {
+	websuburl, err := url.Parse(Config.WebSubUrl)
+	if err != nil {
+		return fmt.Errorf("url.Parse WebSubUrl [%s] %v", Config.WebSubUrl, err)
+	}
+	path := websuburl.Path
+	if path == "" {
+		path = "/"
+	}
+	HttpMux.HandleFunc(path, WebSubHandler)
 
-		if expectsize := int(vinfo.Duration.Seconds()) * audioFormat.Bitrate / 8; copywritten < int64(expectsize/2) {
-			return fmt.Errorf("downloaded audio size is less than half of expected")
-		}
+	WebSubActive.Store(true)
+	return nil
+}
 
-		audioFile := audioSrcFile
+// WebSubTopic is the hub topic of the channel uploads
+func WebSubTopic(channelid string) string {
+	return WebSubTopicUrl + "?" + url.Values{"channel_id": {channelid}}.Encode()
+}
 
-		if Config.FfmpegPath != "" && Config.TgAudioBitrateKbps > 0 {
-			perr(F("DEBUG target audio bitrate <%dkbps>", Config.TgAudioBitrateKbps))
-			audioFile = fmt.Sprintf("%s..%dk..m4a", audioName, Config.TgAudioBitrateKbps)
-			ffmpegArgs := append(Config.FfmpegGlobalOptions,
-				"-i", audioSrcFile,
-				"-b:a", fmt.Sprintf("%dk", Config.TgAudioBitrateKbps),
-				audioFile,
-			)
-			if err = exec.Command(Config.FfmpegPath, ffmpegArgs...).Run(); err != nil {
-				return fmt.Errorf("ffmpeg (%s %v) %v", Config.FfmpegPath, ffmpegArgs, err)
-			}
+// WebSubRenew requests the subscriptions of the channels with the leases missing or expiring soon
+func WebSubRenew() {
+	type sub struct {
+		key       string
+		channelid string
+	}
 
-			if err = os.Remove(audioSrcFile); err != nil {
-				tglog(F("ERROR Remove %s %v", audioSrcFile, err))
-			}
+	Mu.Lock()
+	callback, secret, lease := Config.WebSubUrl, Config.WebSubSecret, Config.WebSubLease
+	var subs []sub
+	for _, channel := range Config.Sources() {
+		if channel.Suspend {
+			continue
 		}
-
-		audioSrc, err = os.Open(audioSrcFile)
-		if err != nil {
-			return fmt.Errorf("Open [%s] %v", audioSrcFile, err)
-		}
-		defer audioSrc.Close()
-
-		var thumbUrl string
-		if v.Thumbnails.Maxres != nil && v.Thumbnails.Maxres.Url != "" {
-			thumbUrl = v.Thumbnails.Maxres.Url
-		} else if v.Thumbnails.Standard != nil && v.Thumbnails.Standard.Url != "" {
-			thumbUrl = v.Thumbnails.Standard.Url
-		} else if v.Thumbnails.High != nil && v.Thumbnails.High.Url != "" {
-			thumbUrl = v.Thumbnails.High.Url
-		} else if v.Thumbnails.Medium != nil && v.Thumbnails.Medium.Url != "" {
-			thumbUrl = v.Thumbnails.Medium.Url
-		} else {
-			return fmt.Errorf("no thumb url")
+		chstate := State.Channel(&channel)
+		channelid := chstate.ChannelId()
+		if channelid == "" {
+			// known after the first check
+			continue
 		}
-
-		var thumbBytes []byte
-		thumbBytes, err = downloadFile(thumbUrl)
-		if err != nil {
-			return fmt.Errorf("download thumb url [%s] %v", thumbUrl, err)
+		if time.Until(chstate.WebSubExpires) > WebSubRenewBefore || time.Since(chstate.WebSubRequested) < WebSubRetryInterval {
+			continue
 		}
+		subs = append(subs, sub{key: channel.Key(), channelid: channelid})
+	}
+	Mu.Unlock()
 
-		if thumbImg, thumbImgFmt, err := image.Decode(bytes.NewReader(thumbBytes)); err != nil {
-			perr(F("ERROR thumb url [%s] decode %v", thumbUrl, err))
-		} else {
-			dx, dy := thumbImg.Bounds().Dx(), thumbImg.Bounds().Dy()
-			perr(F("DEBUG thumb url [%s] fmt [%s] size <%dkb> res <%dx%d>", thumbUrl, thumbImgFmt, len(thumbBytes)>>10, dx, dy))
-			if thumbImgFmt == "webp" {
-				thumbPngBuf := new(bytes.Buffer)
-				png.Encode(thumbPngBuf, thumbImg)
-				thumbBytes = thumbPngBuf.Bytes()
-				perr(F("DEBUG thumb url [%s] converted to fmt [png] size <%dkb>", thumbUrl, len(thumbBytes)>>10))
-			}
+	for _, sub := range subs {
+		perr(F("DEBUG websub subscribe %s [%s]", sub.key, sub.channelid))
+		if err := WebSubSubscribe(callback, secret, lease, sub.channelid); err != nil {
+			tglog(F("ERROR websub subscribe %s %v", sub.key, err))
+			continue
+		}
+		Mu.Lock()
+		if chstate, ok := State.Channels[sub.key]; ok {
+			chstate.WebSubRequested = time.Now()
+			StateSave()
 		}
+		Mu.Unlock()
+	}
+}
 
-		if !channel.TgSkipPhoto {
+// WebSubSubscribe asks the hub to subscribe, the hub verifies it with a callback request
+func WebSubSubscribe(callback, secret string, lease time.Duration, channelid string) error {
+	resp, err := HttpClient.PostForm(WebSubHubUrl, url.Values{
+		"hub.callback":      {callback},
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {WebSubTopic(channelid)},
+		"hub.verify":        {"async"},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {F("%d", int64(lease.Seconds()))},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-			var tgcover tg.PhotoSize
-			if tgmsg, err := tg.SendPhotoFile(tg.SendPhotoFileRequest{
-				ChatId:   channel.TgChatId,
-				FileName: audioName + "..photo",
-				Photo:    bytes.NewReader(thumbBytes),
-			}); err != nil {
-				return fmt.Errorf("ERROR tg.SendPhotoFile %v", err)
-			} else {
-				for _, p := range tgmsg.Photo {
-					if p.Width > tgcover.Width {
-						tgcover = p
-					}
-				}
-				if tgcover.FileId == "" {
-					return fmt.Errorf("ERROR tg.SendPhotoFile file_id empty")
-				}
-				if err := tg.DeleteMessage(tg.DeleteMessageRequest{
-					ChatId:    channel.TgChatId,
-					MessageId: tgmsg.MessageId,
-				}); err != nil {
-					perr(F("ERROR tg.DeleteMessage %v", err))
-				}
-			}
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("response status %s [%s]", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
 
-			photoCaption := tg.BoldUnderline(tg.Esc(vtitle))
+// WebSubHandler answers the hub verification requests and queues the announced videos
+func WebSubHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		WebSubVerify(w, r)
+	case http.MethodPost:
+		WebSubNotify(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-			if _, err := tg.SendPhoto(tg.SendPhotoRequest{
-				ChatId:  channel.TgChatId,
-				Photo:   tgcover.FileId,
-				Caption: photoCaption,
-			}); err != nil {
-				return fmt.Errorf("tg.SendPhoto %v", err)
-			}
+// WebSubVerify confirms the subscriptions of the channels and records the leases
+func WebSubVerify(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mode, topic, challenge := q.Get("hub.mode"), q.Get("hub.topic"), q.Get("hub.challenge")
 
-		}
+	Mu.Lock()
+	defer Mu.Unlock()
 
-		var tgaudio tg.Audio
-		if tgmsg, err := tg.SendAudioFile(tg.SendAudioFileRequest{
-			ChatId:    channel.TgChatId,
-			Performer: channel.TgPerformer,
-			Title:     vtitle,
-			Duration:  vinfo.Duration,
-			Audio:     audioSrc,
-			Thumb:     bytes.NewReader(thumbBytes),
-		}); err != nil {
-			return fmt.Errorf("ERROR tg.SendAudioFile %v", err)
-		} else {
-			tgaudio = tgmsg.Audio
-			if err := tg.DeleteMessage(tg.DeleteMessageRequest{
-				ChatId:    channel.TgChatId,
-				MessageId: tgmsg.MessageId,
-			}); err != nil {
-				perr(F("ERROR tg.DeleteMessage %v", err))
+	var chstate *TgTubeChanChannelState
+	for _, channel := range Config.Sources() {
+		if cs := State.Channel(&channel); cs.ChannelId() != "" && WebSubTopic(cs.ChannelId()) == topic {
+			if !channel.Suspend {
+				chstate = cs
 			}
+			break
 		}
+	}
 
-		if err := os.Remove(audioSrcFile); err != nil {
-			perr(F("ERROR Remove [%s] %v", audioSrcFile, err))
+	switch mode {
+	case "subscribe":
+		if chstate == nil {
+			perr(F("WARNING websub subscribe to unknown topic [%s]", topic))
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		leaseseconds, err := strconv.ParseInt(q.Get("hub.lease_seconds"), 10, 64)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
 		}
+		chstate.WebSubExpires = time.Now().Add(time.Duration(leaseseconds) * time.Second)
+		StateSave()
+		perr(F("websub subscribed [%s] until <%s>", topic, fmttime(chstate.WebSubExpires)))
+	case "unsubscribe":
+		if chstate != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+	case "denied":
+		tglog(F("ERROR websub subscription denied [%s] %s", topic, q.Get("hub.reason")))
+		return
+	default:
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
 
-		audioCaption := tg.Esc(tg.F(
-			"%s"+NL+"%s %s"+NL+"youtu.be/%s %s",
-			vtitle, channel.TgPerformer, vpatime.Format("2006/01/02"), v.ResourceId.VideoId, vinfo.Duration,
-		))
+	w.Write([]byte(challenge))
+}
 
-		if _, err := tg.SendAudio(tg.SendAudioRequest{
-			ChatId:  channel.TgChatId,
-			Audio:   tgaudio.FileId,
-			Caption: audioCaption,
-		}); err != nil {
-			return fmt.Errorf("tg.SendAudio %v", err)
-		}
+// WebSubNotify queues the videos of a notification signed with WebSubSecret
+func WebSubNotify(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
 
-		if !channel.TgSkipDescription {
+	Mu.Lock()
+	secret := Config.WebSubSecret
+	Mu.Unlock()
 
-			var spp []string
-			if len(v.Description) < 4000 {
-				spp = []string{v.Description}
-			} else {
-				var sp string
-				srs := strings.Split(v.Description, NL+NL)
-				for i, s := range srs {
-					sp += s + NL + NL
-					if i == len(srs)-1 || len(sp)+len(srs[i+1]) > 4000 {
-						spp = append(spp, sp)
-						sp = ""
-					}
-				}
-			}
+	// notifications with an invalid signature are acknowledged and ignored as the spec says
+	if !WebSubSignatureValid(secret, r.Header.Get("X-Hub-Signature"), body) {
+		perr(F("WARNING websub notification from [%s] with invalid signature", r.RemoteAddr))
+		return
+	}
 
-			for _, sp := range spp {
-				if strings.TrimSpace(sp) == "" {
-					continue
-				}
-				_, err = tg.SendMessage(tg.SendMessageRequest{
-					ChatId: channel.TgChatId,
-					Text:   tg.Esc(sp),
+	items, err := ytFeedParse(body)
+	if err != nil {
+		perr(F("ERROR websub notification ytFeedParse %v", err))
+		return
+	}
 
-					LinkPreviewOptions: tg.LinkPreviewOptions{IsDisabled: true},
-				})
-				if err != nil {
-					return fmt.Errorf("tg.SendMessage %v", err)
-				}
+	Mu.Lock()
+	for _, item := range items {
+		for _, channel := range Config.Sources() {
+			chstate := State.Channel(&channel)
+			if channel.Suspend || chstate.ChannelId() != item.ChannelId {
+				continue
+			}
+			perr(F("websub %s youtu.be/%s [%s]", channel.Key(), item.ResourceId.VideoId, item.Title))
+			if !slices.Contains(chstate.WebSubVideos, item.ResourceId.VideoId) {
+				chstate.WebSubVideos = append(chstate.WebSubVideos, item.ResourceId.VideoId)
 			}
-
 		}
+	}
+	StateSave()
+	Mu.Unlock()
 
-		channel.YtLast = vpatime.Format(time.RFC3339)
-		if err := Config.Put(); err != nil {
-			return fmt.Errorf("Config.Put %v", err)
-		}
+	SchedulerPoke()
+}
 
-		if len(videos) > 3 {
-			perr(F("DEBUG %s sleeping <%v>", channel.YtUsername, Config.TgPlaylistVideosInterval))
-			time.Sleep(Config.TgPlaylistVideosInterval)
-		}
+// WebSubSignatureValid checks the X-Hub-Signature header [method=hexdigest] of the body
+func WebSubSignatureValid(secret, signature string, body []byte) bool {
+	method, digest, ok := strings.Cut(signature, "=")
+	if !ok {
+		return false
 	}
-
-	return nil
+	var hashnew func() hash.Hash
+	switch method {
+	case "sha1":
+		hashnew = sha1.New
+	case "sha256":
+		hashnew = sha256.New
+	case "sha384":
+		hashnew = sha512.New384
+	case "sha512":
+		hashnew = sha512.New
+	default:
+		return false
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(hashnew, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sum, mac.Sum(nil))
 }
 
 type ThrottledReader struct {
@@ -918,6 +4677,106 @@ func (sr *ThrottledReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
+// squareCover makes the TgThumbSize square jpeg thumb of the image by the TgCoverMode, the avatar is used when not nil
+func squareCover(img image.Image, mode string, avatar image.Image) ([]byte, error) {
+	square := image.Rect(0, 0, TgThumbSize, TgThumbSize)
+	cover := image.NewRGBA(square)
+
+	switch {
+	case mode == TgCoverAvatar && avatar != nil:
+		xdraw.CatmullRom.Scale(cover, square, avatar, centerSquare(avatar.Bounds()), xdraw.Src, nil)
+	case mode == TgCoverBlur:
+		// the background is the center square scaled down and back up
+		small := image.NewRGBA(image.Rect(0, 0, 12, 12))
+		xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, centerSquare(img.Bounds()), xdraw.Src, nil)
+		xdraw.BiLinear.Scale(cover, square, small, small.Bounds(), xdraw.Src, nil)
+		b := img.Bounds()
+		w, h := TgThumbSize, TgThumbSize
+		if b.Dx() > b.Dy() {
+			h = TgThumbSize * b.Dy() / b.Dx()
+		} else {
+			w = TgThumbSize * b.Dx() / b.Dy()
+		}
+		fit := image.Rect((TgThumbSize-w)/2, (TgThumbSize-h)/2, (TgThumbSize+w)/2, (TgThumbSize+h)/2)
+		xdraw.CatmullRom.Scale(cover, fit, img, b, xdraw.Src, nil)
+	default:
+		xdraw.CatmullRom.Scale(cover, square, img, centerSquare(img.Bounds()), xdraw.Src, nil)
+	}
+
+	for quality := 90; ; quality -= 10 {
+		buf := new(bytes.Buffer)
+		if err := jpeg.Encode(buf, cover, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("jpeg.Encode %v", err)
+		}
+		if buf.Len() < TgThumbSizeMaxKb<<10 || quality <= 30 {
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+// centerSquare is the biggest square in the center of the rectangle
+func centerSquare(r image.Rectangle) image.Rectangle {
+	size := min(r.Dx(), r.Dy())
+	x, y := r.Min.X+(r.Dx()-size)/2, r.Min.Y+(r.Dy()-size)/2
+	return image.Rect(x, y, x+size, y+size)
+}
+
+// YtAvatar is a decoded channel avatar cached for YtAvatarKeep
+type YtAvatar struct {
+	Image image.Image
+	Got   time.Time
+}
+
+// ytChannelAvatar gets the biggest avatar of the youtube channel, cached by channel id
+func ytChannelAvatar(job *TgTubeChanJob, channelid string) (image.Image, error) {
+	if channelid == "" {
+		return nil, fmt.Errorf("channel id empty")
+	}
+
+	YtAvatarsMu.Lock()
+	cached, ok := YtAvatars[channelid]
+	YtAvatarsMu.Unlock()
+	if ok && time.Since(cached.Got) < YtAvatarKeep {
+		return cached.Image, nil
+	}
+
+	// https://developers.google.com/youtube/v3/docs/channels/list
+	channelslist, err := job.YtSvc.Channels.List([]string{"snippet"}).Id(channelid).Do()
+	if err != nil {
+		return nil, fmt.Errorf("channels/list %v", err)
+	}
+	if len(channelslist.Items) == 0 || channelslist.Items[0].Snippet.Thumbnails == nil {
+		return nil, fmt.Errorf("channels/list [%s] empty result", channelid)
+	}
+
+	var avatarUrl string
+	thumbs := channelslist.Items[0].Snippet.Thumbnails
+	for _, t := range []*youtube.Thumbnail{thumbs.Maxres, thumbs.High, thumbs.Medium, thumbs.Default} {
+		if t != nil && t.Url != "" {
+			avatarUrl = t.Url
+			break
+		}
+	}
+	if avatarUrl == "" {
+		return nil, fmt.Errorf("channel [%s] no avatar url", channelid)
+	}
+
+	avatarBytes, err := downloadFile(avatarUrl)
+	if err != nil {
+		return nil, fmt.Errorf("download avatar url [%s] %v", avatarUrl, err)
+	}
+	avatar, _, err := image.Decode(bytes.NewReader(avatarBytes))
+	if err != nil {
+		return nil, fmt.Errorf("avatar url [%s] decode %v", avatarUrl, err)
+	}
+
+	YtAvatarsMu.Lock()
+	YtAvatars[channelid] = YtAvatar{Image: avatar, Got: time.Now()}
+	YtAvatarsMu.Unlock()
+
+	return avatar, nil
+}
+
 func downloadFile(url string) ([]byte, error) {
 	resp, err := HttpClient.Get(url)
 	if err != nil {
@@ -971,23 +4830,31 @@ func fmttime(t time.Time) string {
 }
 
 func perr(msgtext string) {
-	if strings.HasPrefix(msgtext, "DEBUG ") && !Config.DEBUG {
+	config := ConfigSnap.Load()
+	if config == nil {
+		config = &TgTubeChanConfig{}
+	}
+	if strings.HasPrefix(msgtext, "DEBUG ") && !config.DEBUG {
 		return
 	}
 	tnow := time.Now()
-	if Config.TgToken != "" {
-		msgtext = strings.ReplaceAll(msgtext, Config.TgToken, "[Config.TgToken]")
+	if config.TgToken != "" {
+		msgtext = strings.ReplaceAll(msgtext, config.TgToken, "[Config.TgToken]")
 	}
-	if Config.YtKey != "" {
-		msgtext = strings.ReplaceAll(msgtext, Config.YtKey, "[Config.YtKey]")
+	if config.YtKey != "" {
+		msgtext = strings.ReplaceAll(msgtext, config.YtKey, "[Config.YtKey]")
 	}
 	fmt.Fprint(os.Stderr, "<"+fmttime(tnow)+">"+SP+msgtext+NL)
 }
 
 func tglog(msgtext string) (err error) {
 	perr(msgtext)
+	config := ConfigSnap.Load()
+	if config == nil {
+		return fmt.Errorf("no config")
+	}
 	if _, err = tg.SendMessage(tg.SendMessageRequest{
-		ChatId: Config.TgChatId,
+		ChatId: config.TgChatId,
 		Text:   tg.Esc(msgtext),
 
 		DisableNotification: true,
@@ -999,15 +4866,313 @@ func tglog(msgtext string) (err error) {
 }
 
 func (config *TgTubeChanConfig) Get() error {
-	req, err := http.NewRequest(http.MethodGet, config.YssUrl, nil)
+	if ConfigStorage == nil {
+		return fmt.Errorf("ConfigStorage nil")
+	}
+
+	if err := ConfigStorage.Get(config); err != nil {
+		return err
+	}
+
+	//perr(F("DEBUG Config.Get %+v", config))
+
+	return nil
+}
+
+func (config *TgTubeChanConfig) Put() error {
+	//perr(F("DEBUG Config.Put %+v", config))
+
+	if ConfigStorage == nil {
+		return fmt.Errorf("ConfigStorage nil")
+	}
+
+	return ConfigStorage.Put(config)
+}
+
+// ConfigEdit applies edit to Config, checks and puts it in the Writer goroutine,
+// edit is called with Mu held
+func ConfigEdit(edit func(config *TgTubeChanConfig) error) error {
+	return Write(func() error {
+		return configEdit(edit)
+	})
+}
+
+// configEdit on a revision conflict gets the fresh config, applies edit to it again and retries
+func configEdit(edit func(config *TgTubeChanConfig) error) error {
+	for i := 0; ; i++ {
+		Mu.Lock()
+		saved := Config
+		saved.Channels = slices.Clone(Config.Channels)
+
+		// the edited config goes through the same checks as the one from ConfigGet
+		if err := edit(&Config); err != nil {
+			Config = saved
+			Mu.Unlock()
+			return err
+		}
+		if err := ConfigCheck(); err != nil {
+			Config = saved
+			Mu.Unlock()
+			return err
+		}
+
+		// ConfigCheck made the snapshot to put without holding Mu
+		snap := ConfigSnap.Load()
+		Mu.Unlock()
+
+		err := snap.Put()
+		if err != ErrConfigConflict || i >= ConfigPutRetries {
+			return err
+		}
+
+		perr(F("WARNING Config.Put %v, applying the edit to the fresh config", err))
+
+		if err := ConfigGet(); err != nil {
+			return fmt.Errorf("ConfigGet %v", err)
+		}
+	}
+}
+
+// TgTubeChanWrite is a function for Writer to run and the channel for its result
+type TgTubeChanWrite struct {
+	Func func() error
+	Done chan error
+}
+
+// Write runs f in the Writer goroutine and waits for its result
+func Write(f func() error) error {
+	done := make(chan error, 1)
+	Writes <- TgTubeChanWrite{Func: f, Done: done}
+	return <-done
+}
+
+// Writer is the only goroutine getting and putting the config and the state
+func Writer() {
+	for {
+		select {
+		case <-StateDirty:
+			if err := StatePut(); err != nil {
+				perr(F("ERROR StatePut %v", err))
+			}
+		case w := <-Writes:
+			w.Done <- w.Func()
+		}
+	}
+}
+
+// StateSave asks Writer to put the state, calls made before it gets to it end up in one put
+func StateSave() {
+	select {
+	case StateDirty <- struct{}{}:
+	default:
+	}
+}
+
+// StatePut puts a copy of the state made with Mu held
+func StatePut() error {
+	Mu.Lock()
+	sbb, err := yaml.Marshal(&State)
+	Mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("yaml.Marshal %v", err)
+	}
+
+	var snap TgTubeChanState
+	if err := yaml.Unmarshal(sbb, &snap); err != nil {
+		return fmt.Errorf("yaml.Unmarshal %v", err)
+	}
+
+	return snap.Put()
+}
+
+func (state *TgTubeChanState) Get() error {
+	if StateStorage == nil {
+		return fmt.Errorf("StateStorage nil")
+	}
+
+	if err := StateStorage.Get(state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else if err != nil {
+		perr(F("WARNING State.Get %v, starting with empty state", err))
+	}
+
+	if state.Channels == nil {
+		state.Channels = make(map[string]*TgTubeChanChannelState)
+	}
+
+	perr(F("TgUpdateLog %v", state.TgUpdateLog))
+	for key, chstate := range state.Channels {
+		if chstate.YtCheckLast.IsZero() {
+			chstate.YtCheckLast = state.YtCheckLast
+		}
+		perr(F("DEBUG { @Channel [%s] @YtLast <%s> @YtCheckLast <%s> }", key, chstate.YtLast, chstate.YtCheckLast))
+	}
+	state.YtCheckLast = time.Time{}
+
+	return nil
+}
+
+func (state *TgTubeChanState) Put() error {
+	if StateStorage == nil {
+		return fmt.Errorf("StateStorage nil")
+	}
+
+	return StateStorage.Put(state)
+}
+
+// Channel returns the state of channel creating it from the legacy config fields if it is missing
+func (state *TgTubeChanState) Channel(channel *TgTubeChanChannel) *TgTubeChanChannelState {
+	if chstate, ok := state.Channels[channel.Key()]; ok {
+		return chstate
+	}
+	chstate := &TgTubeChanChannelState{
+		YtChannelId:  channel.YtChannelId,
+		YtPlaylistId: channel.YtPlaylistId,
+		YtLast:       channel.YtLast,
+		YtCheckLast:  state.YtCheckLast,
+	}
+	state.Channels[channel.Key()] = chstate
+	return chstate
+}
+
+// Prune drops the ledger entries not updated for YtLedgerKeep and not seen in the last listing
+func (chstate *TgTubeChanChannelState) Prune(seen map[string]bool) {
+	for videoid, video := range chstate.Videos {
+		if video.Done() && time.Since(video.Updated) > Config.YtLedgerKeep && !seen[videoid] {
+			delete(chstate.Videos, videoid)
+		}
+	}
+}
+
+// MessageIdsAdd records the message id and kind posted to the chat of the channel
+func (video *TgTubeChanVideo) MessageIdsAdd(channel *TgTubeChanChannel, chatid string, messageid int64, kind string) {
+	if chatid == channel.TgChatId {
+		video.TgMessageIds = append(video.TgMessageIds, messageid)
+		video.TgMessageKinds = append(video.TgMessageKinds, kind)
+		return
+	}
+	if video.TgDestMessageIds == nil {
+		video.TgDestMessageIds = make(map[string][]int64)
+		video.TgDestMessageKinds = make(map[string][]string)
+	}
+	video.TgDestMessageIds[chatid] = append(video.TgDestMessageIds[chatid], messageid)
+	video.TgDestMessageKinds[chatid] = append(video.TgDestMessageKinds[chatid], kind)
+}
+
+// MessageIdsSet replaces the message ids and kinds posted to the chat of the channel
+func (video *TgTubeChanVideo) MessageIdsSet(channel *TgTubeChanChannel, chatid string, messageids []int64, kinds []string) {
+	if chatid == channel.TgChatId {
+		video.TgMessageIds, video.TgMessageKinds = messageids, kinds
+		return
+	}
+	if len(messageids) == 0 {
+		delete(video.TgDestMessageIds, chatid)
+		delete(video.TgDestMessageKinds, chatid)
+		return
+	}
+	if video.TgDestMessageIds == nil {
+		video.TgDestMessageIds = make(map[string][]int64)
+		video.TgDestMessageKinds = make(map[string][]string)
+	}
+	video.TgDestMessageIds[chatid], video.TgDestMessageKinds[chatid] = messageids, kinds
+}
+
+// MessageIdsRemove drops the message id and its kind posted to the chat of the channel
+func (video *TgTubeChanVideo) MessageIdsRemove(channel *TgTubeChanChannel, chatid string, messageid int64) {
+	ids, kinds := video.MessageIds(channel, chatid)
+	var keepids []int64
+	var keepkinds []string
+	for i, id := range ids {
+		if id == messageid {
+			continue
+		}
+		keepids = append(keepids, id)
+		if i < len(kinds) {
+			keepkinds = append(keepkinds, kinds[i])
+		}
+	}
+	video.MessageIdsSet(channel, chatid, keepids, keepkinds)
+}
+
+// MessageIds returns the message ids and kinds posted to the chat of the channel
+func (video *TgTubeChanVideo) MessageIds(channel *TgTubeChanChannel, chatid string) (ids []int64, kinds []string) {
+	if chatid == channel.TgChatId {
+		return video.TgMessageIds, video.TgMessageKinds
+	}
+	return video.TgDestMessageIds[chatid], video.TgDestMessageKinds[chatid]
+}
+
+// Copy is a copy of the video with its own message ids and kinds to change without holding Mu
+func (video *TgTubeChanVideo) Copy() TgTubeChanVideo {
+	vc := *video
+	vc.TgMessageIds, vc.TgMessageKinds = slices.Clone(video.TgMessageIds), slices.Clone(video.TgMessageKinds)
+	if video.TgDestMessageIds != nil {
+		vc.TgDestMessageIds = make(map[string][]int64)
+		vc.TgDestMessageKinds = make(map[string][]string)
+		for chatid, ids := range video.TgDestMessageIds {
+			vc.TgDestMessageIds[chatid] = slices.Clone(ids)
+			vc.TgDestMessageKinds[chatid] = slices.Clone(video.TgDestMessageKinds[chatid])
+		}
+	}
+	vc.TgPostedChatIds = slices.Clone(video.TgPostedChatIds)
+	vc.TgParts = slices.Clone(video.TgParts)
+	return vc
+}
+
+// Done tells if the video needs no more attempts
+func (video *TgTubeChanVideo) Done() bool {
+	if video == nil {
+		return false
+	}
+	switch video.Status {
+	case VideoPosted, VideoSkippedUnplayable, VideoSkippedAge, VideoRemoved:
+		return true
+	case VideoFailed:
+		return video.Attempts >= Config.YtRetryMax
+	}
+	return false
+}
+
+// Key identifies channel in the state
+func (channel *TgTubeChanChannel) Key() string {
+	if channel.Name != "" {
+		return channel.Name
+	}
+	if channel.YtUsername != "" {
+		return channel.YtUsername
+	}
+	return channel.YtPlaylistId
+}
+
+// ConfigStore loads and saves a yaml document
+type ConfigStore interface {
+	Get(v interface{}) error
+	Put(v interface{}) error
+}
+
+// YssConfigStore keeps the document in yss over http GET and PUT,
+// the ETag of the last Get or Put is sent as If-Match so a document edited meanwhile is not overwritten
+type YssConfigStore struct {
+	Url  string
+	ETag string
+
+	Overwrite bool // put without If-Match, for the documents with the only writer
+}
+
+func (store *YssConfigStore) Get(v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, store.Url, nil)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := HttpClient.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("yss response status %s %w", resp.Status, os.ErrNotExist)
+	}
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("yss response status %s", resp.Status)
 	}
@@ -1017,35 +5182,133 @@ func (config *TgTubeChanConfig) Get() error {
 		return err
 	}
 
-	if err := yaml.Unmarshal(rbb, config); err != nil {
+	if err := yaml.Unmarshal(rbb, v); err != nil {
 		return err
 	}
 
-	//perr(F("DEBUG Config.Get %+v", config))
+	store.ETag = resp.Header.Get("ETag")
 
 	return nil
 }
 
-func (config *TgTubeChanConfig) Put() error {
-	//perr(F("DEBUG Config.Put %s %+v", config.YssUrl, config))
-
-	rbb, err := yaml.MarshalWithOptions(config, yaml.JSON(), yaml.Flow(false))
+func (store *YssConfigStore) Put(v interface{}) error {
+	rbb, err := yaml.MarshalWithOptions(v, yaml.JSON(), yaml.Flow(false))
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPut, config.YssUrl, bytes.NewBuffer(rbb))
+	req, err := http.NewRequest(http.MethodPut, store.Url, bytes.NewBuffer(rbb))
 	if err != nil {
 		return err
 	}
+	if store.ETag != "" && !store.Overwrite {
+		req.Header.Set("If-Match", store.ETag)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := HttpClient.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return ErrConfigConflict
+	}
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("yss response status %s", resp.Status)
 	}
 
+	store.ETag = resp.Header.Get("ETag")
+
+	return nil
+}
+
+// FileConfigStore keeps the document in a local yaml file or json file if the path ends with .json,
+// the file modification time seen on the last Get or Put is the revision checked before writing
+type FileConfigStore struct {
+	Path    string
+	ModTime time.Time
+
+	Overwrite bool // put without checking ModTime, for the documents with the only writer
+}
+
+func (store *FileConfigStore) Get(v interface{}) error {
+	fi, err := os.Stat(store.Path)
+	if err != nil {
+		return err
+	}
+
+	rbb, err := os.ReadFile(store.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(rbb, v); err != nil {
+		return fmt.Errorf("yaml.Unmarshal [%s] %v", store.Path, err)
+	}
+
+	store.ModTime = fi.ModTime()
+
+	return nil
+}
+
+func (store *FileConfigStore) Put(v interface{}) (err error) {
+	if fi, err := os.Stat(store.Path); err == nil && !store.Overwrite && !store.ModTime.IsZero() && !fi.ModTime().Equal(store.ModTime) {
+		return ErrConfigConflict
+	}
+
+	var rbb []byte
+	if strings.HasSuffix(store.Path, ".json") {
+		rbb, err = yaml.MarshalWithOptions(v, yaml.JSON(), yaml.Flow(false))
+	} else {
+		rbb, err = yaml.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file in the same dir then rename it over the path so readers never see a partial document
+	dir := filepath.Dir(store.Path)
+	tmpf, err := os.CreateTemp(dir, filepath.Base(store.Path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("CreateTemp [%s] %v", dir, err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmpf.Name())
+		}
+	}()
+
+	if _, err = tmpf.Write(rbb); err != nil {
+		tmpf.Close()
+		return fmt.Errorf("Write [%s] %v", tmpf.Name(), err)
+	}
+	if err = tmpf.Sync(); err != nil {
+		tmpf.Close()
+		return fmt.Errorf("Sync [%s] %v", tmpf.Name(), err)
+	}
+	if err = tmpf.Close(); err != nil {
+		return fmt.Errorf("Close [%s] %v", tmpf.Name(), err)
+	}
+	if fi, staterr := os.Stat(store.Path); staterr == nil {
+		if err = os.Chmod(tmpf.Name(), fi.Mode().Perm()); err != nil {
+			return fmt.Errorf("Chmod [%s] %v", tmpf.Name(), err)
+		}
+	}
+
+	if err = os.Rename(tmpf.Name(), store.Path); err != nil {
+		return fmt.Errorf("Rename [%s] [%s] %v", tmpf.Name(), store.Path, err)
+	}
+
+	if fi, err := os.Stat(store.Path); err == nil {
+		store.ModTime = fi.ModTime()
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		if err := d.Sync(); err != nil {
+			perr(F("ERROR Sync [%s] %v", dir, err))
+		}
+		d.Close()
+	}
+
 	return nil
 }
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestYtFeedParse(t *testing.T) {
+	data, err := os.ReadFile("testdata/ytfeed.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := ytFeedParse(data)
+	if err != nil {
+		t.Fatalf("ytFeedParse %v", err)
+	}
+
+	// sorted by date desc, published in utc
+	tests := []struct {
+		videoid, title, publishedAt, description, thumb string
+	}{
+		{"Ee4Ff5Gg6Hh", "Night Train", "2025-05-04T01:00:00Z", "", "https://i3.ytimg.com/vi/Ee4Ff5Gg6Hh/hqdefault.jpg"},
+		{"Aa1Bb2Cc3Dd", "Morning Birds & Rain", "2025-05-01T06:30:00Z", "00:00 Birds\n12:30 Rain", "https://i2.ytimg.com/vi/Aa1Bb2Cc3Dd/hqdefault.jpg"},
+		{"Ii7Jj8Kk9Ll", "Harbour at Dusk", "2025-04-20T19:45:10Z", "Gulls and ropes.", ""},
+	}
+	if len(items) != len(tests) {
+		t.Fatalf("items <%d> want <%d>", len(items), len(tests))
+	}
+	for i, tt := range tests {
+		item := items[i]
+		if item.ResourceId == nil || item.ResourceId.VideoId != tt.videoid {
+			t.Errorf("item <%d> ResourceId %+v want [%s]", i, item.ResourceId, tt.videoid)
+			continue
+		}
+		if item.Title != tt.title {
+			t.Errorf("%s Title [%s] want [%s]", tt.videoid, item.Title, tt.title)
+		}
+		if item.PublishedAt != tt.publishedAt {
+			t.Errorf("%s PublishedAt [%s] want [%s]", tt.videoid, item.PublishedAt, tt.publishedAt)
+		}
+		if item.Description != tt.description {
+			t.Errorf("%s Description [%s] want [%s]", tt.videoid, item.Description, tt.description)
+		}
+		if item.ChannelId != "UCb2c3d4e5f6g7h8i9j0k1lm" || item.ChannelTitle != "Field Recordings" {
+			t.Errorf("%s ChannelId [%s] ChannelTitle [%s]", tt.videoid, item.ChannelId, item.ChannelTitle)
+		}
+		if item.Thumbnails == nil {
+			t.Errorf("%s Thumbnails nil", tt.videoid)
+			continue
+		}
+		// the letterboxed feed thumb does not stand for the videos/list ones
+		if item.Thumbnails.Maxres != nil || item.Thumbnails.Standard != nil || item.Thumbnails.High != nil || item.Thumbnails.Medium != nil {
+			t.Errorf("%s Thumbnails %+v want Default only", tt.videoid, item.Thumbnails)
+		}
+		if u := ytThumbUrl(item.Thumbnails); u != tt.thumb {
+			t.Errorf("%s ytThumbUrl [%s] want [%s]", tt.videoid, u, tt.thumb)
+		}
+		if tt.thumb == "" {
+			continue
+		}
+		if def := item.Thumbnails.Default; def.Width != 480 || def.Height != 360 {
+			t.Errorf("%s Thumbnails.Default %+v want 480x360", tt.videoid, def)
+		}
+	}
+}
+
+func TestYtFeedParseMalformed(t *testing.T) {
+	truncated, err := os.ReadFile("testdata/ytfeed-malformed.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"truncated", string(truncated)},
+		{"no videoId", `<feed xmlns="http://www.w3.org/2005/Atom"><entry><title>t</title><published>2025-05-01T06:30:00+00:00</published></entry></feed>`},
+		{"bad published", `<feed xmlns="http://www.w3.org/2005/Atom" xmlns:yt="http://www.youtube.com/xml/schemas/2015"><entry><yt:videoId>Aa1Bb2Cc3Dd</yt:videoId><published>yesterday</published></entry></feed>`},
+	}
+	for _, tt := range tests {
+		if items, err := ytFeedParse([]byte(tt.data)); err == nil {
+			t.Errorf("%s no error, items %+v", tt.name, items)
+		}
+	}
+}
+
+func TestAudioCuts(t *testing.T) {
+	m := time.Minute
+	tests := []struct {
+		name     string
+		duration time.Duration
+		n        int
+		partmax  time.Duration
+		prefer   []time.Duration
+		cuts     []time.Duration
+	}{
+		{"one part", 10 * m, 1, 10 * m, nil, []time.Duration{0, 10 * m}},
+		{"even", 100 * m, 4, 27 * m, nil, []time.Duration{0, 25 * m, 50 * m, 75 * m, 100 * m}},
+		{"prefer near", 100 * m, 4, 27 * m, []time.Duration{24 * m, 90 * m}, []time.Duration{0, 24 * m, 50 * m, 75 * m, 100 * m}},
+		{"prefer too far", 100 * m, 4, 27 * m, []time.Duration{18 * m, 57 * m}, []time.Duration{0, 25 * m, 50 * m, 75 * m, 100 * m}},
+		{"prefer making a part longer than partmax", 100 * m, 4, 27 * m, []time.Duration{31 * m}, []time.Duration{0, 25 * m, 50 * m, 75 * m, 100 * m}},
+		{"early cut pulls the rest", 100 * m, 4, 27 * m, []time.Duration{19 * m, 44 * m}, []time.Duration{0, 19 * m, 46 * m, 73 * m, 100 * m}},
+		{"partmax less than part", 100 * m, 4, 0, []time.Duration{24 * m}, []time.Duration{0, 25 * m, 50 * m, 75 * m, 100 * m}},
+	}
+	for _, tt := range tests {
+		cuts := audioCuts(tt.duration, tt.n, tt.partmax, tt.prefer)
+		if !slices.Equal(cuts, tt.cuts) {
+			t.Errorf("%s cuts %v want %v", tt.name, cuts, tt.cuts)
+			continue
+		}
+		for i := 1; i < len(cuts); i++ {
+			if part := cuts[i] - cuts[i-1]; part <= 0 || part > max(tt.partmax, tt.duration/time.Duration(tt.n)) {
+				t.Errorf("%s part <%d> duration <%v>", tt.name, i, part)
+			}
+		}
+	}
+}
+
+func TestYtChapters(t *testing.T) {
+	m, s := time.Minute, time.Second
+	tests := []struct {
+		name        string
+		description string
+		duration    time.Duration
+		chapters    []Chapter
+	}{
+		{
+			"leading timestamps",
+			"Live at the harbour\n\n0:00 Intro\n1:30 Artist - Song\n10:05 Outro\n\nthanks",
+			15 * m,
+			[]Chapter{
+				{Start: 0, End: 90 * s, Title: "Intro"},
+				{Start: 90 * s, End: 10*m + 5*s, Title: "Song", Performer: "Artist"},
+				{Start: 10*m + 5*s, End: 15 * m, Title: "Outro"},
+			},
+		},
+		{
+			"trailing timestamps",
+			"Start 0:00\nMiddle (2:00)\nArtist – End - 1:02:03",
+			2 * time.Hour,
+			[]Chapter{
+				{Start: 0, End: 2 * m, Title: "Start"},
+				{Start: 2 * m, End: time.Hour + 2*m + 3*s, Title: "Middle"},
+				{Start: time.Hour + 2*m + 3*s, End: 2 * time.Hour, Title: "End", Performer: "Artist"},
+			},
+		},
+		{
+			"hours",
+			"00:00 a\n05:00 b\n1:00:00 c",
+			2 * time.Hour,
+			[]Chapter{
+				{Start: 0, End: 5 * m, Title: "a"},
+				{Start: 5 * m, End: time.Hour, Title: "b"},
+				{Start: time.Hour, End: 2 * time.Hour, Title: "c"},
+			},
+		},
+		{
+			"timestamps past the duration",
+			"0:00 a\n1:00 b\n2:00 c\n9:00 d",
+			5 * m,
+			[]Chapter{
+				{Start: 0, End: 1 * m, Title: "a"},
+				{Start: 1 * m, End: 2 * m, Title: "b"},
+				{Start: 2 * m, End: 5 * m, Title: "c"},
+			},
+		},
+		{"two", "0:00 a\n1:00 b", 5 * m, nil},
+		{"not from zero", "0:10 a\n1:00 b\n2:00 c", 5 * m, nil},
+		{"not ascending", "0:00 a\n2:00 b\n1:00 c\n3:00 d", 5 * m, nil},
+		{"no timestamps", "just a description", 5 * m, nil},
+	}
+	for _, tt := range tests {
+		chapters := ytChapters(tt.description, tt.duration)
+		if !slices.Equal(chapters, tt.chapters) {
+			t.Errorf("%s chapters %+v want %+v", tt.name, chapters, tt.chapters)
+		}
+	}
+}
+
+func TestChaptersCaption(t *testing.T) {
+	m, s := time.Minute, time.Second
+	chapters := []Chapter{
+		{Start: 0, End: 90 * s, Title: "Intro"},
+		{Start: 90 * s, End: 10*m + 5*s, Title: "Song", Performer: "Artist"},
+		{Start: 10*m + 5*s, End: 15 * m, Title: "Outro"},
+	}
+	tests := []struct {
+		start, end time.Duration
+		caption    string
+	}{
+		{0, 15 * m, "0:00 Intro\n1:30 Artist - Song\n10:05 Outro"},
+		{1 * m, 11 * m, "0:30 Artist - Song\n9:05 Outro"},
+		{90 * s, 10*m + 5*s, "0:00 Artist - Song"},
+		{11 * m, 15 * m, ""},
+	}
+	for _, tt := range tests {
+		if caption := chaptersCaption(chapters, tt.start, tt.end); caption != tt.caption {
+			t.Errorf("start <%v> end <%v> caption [%s] want [%s]", tt.start, tt.end, caption, tt.caption)
+		}
+	}
+}
+
+func TestFmtTimestamp(t *testing.T) {
+	tests := []struct {
+		d  time.Duration
+		ts string
+	}{
+		{0, "0:00"},
+		{65 * time.Second, "1:05"},
+		{59*time.Minute + 59*time.Second + 900*time.Millisecond, "59:59"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+		{10 * time.Hour, "10:00:00"},
+	}
+	for _, tt := range tests {
+		if ts := fmtTimestamp(tt.d); ts != tt.ts {
+			t.Errorf("fmtTimestamp <%v> [%s] want [%s]", tt.d, ts, tt.ts)
+		}
+	}
+}
+
+func TestTgTextLen(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{`a\.b`, 3},
+		{`\\`, 1},
+		{`\\\.`, 2},
+		{`youtu\.be/x 3m0s`, 15},
+		{"ёж — ok", 7},
+	}
+	for _, tt := range tests {
+		if n := tgTextLen(tt.text); n != tt.n {
+			t.Errorf("tgTextLen [%s] <%d> want <%d>", tt.text, n, tt.n)
+		}
+	}
+}
+
+func TestCaptionRender(t *testing.T) {
+	data := TgTubeChanCaption{
+		Title:       "Song (official)",
+		CleanTitle:  "Song",
+		Performer:   "Band",
+		Duration:    3 * time.Minute,
+		PublishedAt: time.Date(2025, 5, 1, 6, 30, 0, 0, time.UTC),
+		VideoId:     "Aa1Bb2Cc3Dd",
+		Part:        1,
+		Parts:       1,
+	}
+	withChapters, withDescription, withTitle := data, data, data
+	withChapters.Chapters = strings.Repeat("0:00 chapter\n", 200)
+	withDescription.Description = strings.Repeat("a-b. ", 1000)
+	withTitle.Title = strings.Repeat("T", 2000)
+
+	tests := []struct {
+		name   string
+		text   string
+		data   TgTubeChanCaption
+		size   int
+		prefix string
+		err    bool
+	}{
+		{"default fits", TgAudioCaptionTemplateDefault, data, TgCaptionSizeMax, "Song\nBand 2025/05/01\nyoutu\\.be/Aa1Bb2Cc3Dd 3m0s", false},
+		{"default cuts the chapters", TgAudioCaptionTemplateDefault, withChapters, TgCaptionSizeMax, "Song\nBand 2025/05/01\nyoutu\\.be/Aa1Bb2Cc3Dd 3m0s\n\n0:00 chapter", false},
+		{"description cut", `{{ esc .Description }}`, withDescription, TgCaptionSizeMax, `a\-b\. a\-b\.`, false},
+		{"description cut with room", `{{ esc .Description }}`, withDescription, TgCaptionSizeMax - 22, `a\-b\. a\-b\.`, false},
+		{"title cut past trunc", `{{ trunc 50 .Description }} {{ esc .Title }}`, withTitle, TgCaptionSizeMax, "TTT", false},
+		{"description not in the template", `{{ esc .Title }}`, withDescription, 100, "Song \\(official\\)", false},
+		{"static text too long", strings.Repeat("x", TgCaptionSizeMax+1), data, TgCaptionSizeMax, "", true},
+		{"unknown field", `{{ .Nope }}`, data, TgCaptionSizeMax, "", true},
+	}
+	for _, tt := range tests {
+		tmpl, err := captionTemplate(tt.text, "")
+		if err != nil {
+			t.Errorf("%s captionTemplate %v", tt.name, err)
+			continue
+		}
+		text, err := captionRender(tmpl, tt.data, tt.size)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s no error, text size <%d>", tt.name, tgTextLen(text))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s captionRender %v", tt.name, err)
+			continue
+		}
+		if n := tgTextLen(text); n > tt.size {
+			t.Errorf("%s text size <%d> more than <%d>", tt.name, n, tt.size)
+		}
+		if !strings.HasPrefix(text, tt.prefix) {
+			t.Errorf("%s text [%.80s] want prefix [%s]", tt.name, text, tt.prefix)
+		}
+	}
+}
+
+func TestVideoDone(t *testing.T) {
+	defer func(retrymax int) { Config.YtRetryMax = retrymax }(Config.YtRetryMax)
+	Config.YtRetryMax = 3
+
+	tests := []struct {
+		video *TgTubeChanVideo
+		done  bool
+	}{
+		{nil, false},
+		{&TgTubeChanVideo{Status: VideoPending, Attempts: 5}, false},
+		{&TgTubeChanVideo{Status: VideoPosted}, true},
+		{&TgTubeChanVideo{Status: VideoSkippedUnplayable}, true},
+		{&TgTubeChanVideo{Status: VideoSkippedAge}, true},
+		{&TgTubeChanVideo{Status: VideoRemoved}, true},
+		{&TgTubeChanVideo{Status: VideoFailed, Attempts: 2}, false},
+		{&TgTubeChanVideo{Status: VideoFailed, Attempts: 3}, true},
+	}
+	for _, tt := range tests {
+		if done := tt.video.Done(); done != tt.done {
+			t.Errorf("%+v Done <%v> want <%v>", tt.video, done, tt.done)
+		}
+	}
+}
+
+func TestChannelStatePrune(t *testing.T) {
+	defer func(retrymax int, keep time.Duration) {
+		Config.YtRetryMax, Config.YtLedgerKeep = retrymax, keep
+	}(Config.YtRetryMax, Config.YtLedgerKeep)
+	Config.YtRetryMax, Config.YtLedgerKeep = 3, 24*time.Hour
+
+	old, recent := time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)
+	tests := []struct {
+		videoid string
+		video   TgTubeChanVideo
+		seen    bool
+		kept    bool
+	}{
+		{"posted-old", TgTubeChanVideo{Status: VideoPosted, Updated: old}, false, false},
+		{"posted-old-seen", TgTubeChanVideo{Status: VideoPosted, Updated: old}, true, true},
+		{"posted-recent", TgTubeChanVideo{Status: VideoPosted, Updated: recent}, false, true},
+		{"removed-old", TgTubeChanVideo{Status: VideoRemoved, Updated: old}, false, false},
+		{"failed-old-retrying", TgTubeChanVideo{Status: VideoFailed, Attempts: 1, Updated: old}, false, true},
+		{"failed-old-given-up", TgTubeChanVideo{Status: VideoFailed, Attempts: 3, Updated: old}, false, false},
+		{"pending-old", TgTubeChanVideo{Status: VideoPending, Updated: old}, false, true},
+	}
+	chstate := &TgTubeChanChannelState{Videos: make(map[string]*TgTubeChanVideo)}
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		video := tt.video
+		chstate.Videos[tt.videoid] = &video
+		seen[tt.videoid] = tt.seen
+	}
+	chstate.Prune(seen)
+	for _, tt := range tests {
+		if _, kept := chstate.Videos[tt.videoid]; kept != tt.kept {
+			t.Errorf("%s kept <%v> want <%v>", tt.videoid, kept, tt.kept)
+		}
+	}
+}
+
+func TestVideoMessageIds(t *testing.T) {
+	channel := &TgTubeChanChannel{TgChatId: "-100", TgDestinations: []TgTubeChanDestination{{TgChatId: "-200"}}}
+
+	video := &TgTubeChanVideo{}
+	video.MessageIdsAdd(channel, "-100", 1, TgMessagePhoto)
+	video.MessageIdsAdd(channel, "-100", 2, TgMessageAudio)
+	video.MessageIdsAdd(channel, "-200", 11, TgMessagePhoto)
+	video.MessageIdsAdd(channel, "-200", 12, TgMessageDescription)
+	video.MessageIdsAdd(channel, "-200", 13, TgMessageDescription)
+
+	vc := video.Copy()
+	vc.MessageIdsRemove(channel, "-200", 12)
+	vc.MessageIdsAdd(channel, "-100", 3, TgMessageDescription)
+
+	tests := []struct {
+		name   string
+		video  *TgTubeChanVideo
+		chatid string
+		ids    []int64
+		kinds  []string
+	}{
+		{"main", video, "-100", []int64{1, 2}, []string{TgMessagePhoto, TgMessageAudio}},
+		{"dest", video, "-200", []int64{11, 12, 13}, []string{TgMessagePhoto, TgMessageDescription, TgMessageDescription}},
+		{"copy main", &vc, "-100", []int64{1, 2, 3}, []string{TgMessagePhoto, TgMessageAudio, TgMessageDescription}},
+		{"copy dest", &vc, "-200", []int64{11, 13}, []string{TgMessagePhoto, TgMessageDescription}},
+		{"unknown", video, "-300", nil, nil},
+	}
+	for _, tt := range tests {
+		ids, kinds := tt.video.MessageIds(channel, tt.chatid)
+		if !slices.Equal(ids, tt.ids) || !slices.Equal(kinds, tt.kinds) {
+			t.Errorf("%s ids %v kinds %v want %v %v", tt.name, ids, kinds, tt.ids, tt.kinds)
+		}
+	}
+
+	video.MessageIdsSet(channel, "-200", nil, nil)
+	if _, ok := video.TgDestMessageIds["-200"]; ok {
+		t.Errorf("MessageIdsSet nil left the dest ids %v", video.TgDestMessageIds)
+	}
+	video.MessageIdsSet(channel, "-100", nil, nil)
+	if len(video.TgMessageIds) != 0 || len(video.TgMessageKinds) != 0 {
+		t.Errorf("MessageIdsSet nil left the ids %v kinds %v", video.TgMessageIds, video.TgMessageKinds)
+	}
+}
+
+func TestChannelSet(t *testing.T) {
+	channel := TgTubeChanChannel{YtUsername: "fieldrecordings", TgChatId: "-100", TgPerformer: "Field", YtLast: "2025-05-01T06:30:00Z"}
+
+	tests := []struct {
+		field, value string
+		check        func(TgTubeChanChannel) bool
+		err          bool
+	}{
+		{"TgPerformer", "Field Recordings", func(c TgTubeChanChannel) bool { return c.TgPerformer == "Field Recordings" }, false},
+		{"TgSkipPhoto", "true", func(c TgTubeChanChannel) bool { return c.TgSkipPhoto }, false},
+		{"TgVideoHeightMax", "480", func(c TgTubeChanChannel) bool { return c.TgVideoHeightMax == 480 }, false},
+		{"TgLoudnessLufs", "-16", func(c TgTubeChanChannel) bool { return c.TgLoudnessLufs == -16 }, false},
+		{"YtCheckInterval", "2h", func(c TgTubeChanChannel) bool { return c.YtCheckInterval == 2*time.Hour }, false},
+		{"TgSkipPhoto", "maybe", nil, true},
+		{"TgVideoHeightMax", "tall", nil, true},
+		{"YtLast", "2025-06-01T00:00:00Z", nil, true},
+		{"NoSuchField", "x", nil, true},
+		// the key changes orphan the state
+		{"Name", "field", nil, true},
+		{"YtUsername", "other", nil, true},
+		{"Sources", "[{YtUsername: other}]", nil, true},
+	}
+	for _, tt := range tests {
+		newchannel, err := ChannelSet(channel, tt.field, tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s [%s] no error", tt.field, tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s [%s] %v", tt.field, tt.value, err)
+			continue
+		}
+		if !tt.check(newchannel) {
+			t.Errorf("%s [%s] channel %+v", tt.field, tt.value, newchannel)
+		}
+		if newchannel.YtUsername != channel.YtUsername || newchannel.TgChatId != channel.TgChatId {
+			t.Errorf("%s [%s] other fields changed %+v", tt.field, tt.value, newchannel)
+		}
+	}
+}
+
+func TestChannelGet(t *testing.T) {
+	channel := TgTubeChanChannel{
+		YtUsername:      "fieldrecordings",
+		TgPerformer:     "Field",
+		TgTitleCleanRe:  "^Field - ",
+		YtCheckInterval: 2 * time.Hour,
+		TgMode:          TgModeBoth,
+		TgAudioCodec:    TgAudioCodecOpus,
+		TgLoudnessLufs:  -16,
+		TgCoverMode:     TgCoverBlur,
+		TgRemovedMode:   TgRemovedNote,
+	}
+	values := map[string]string{
+		"TgPerformer":     "Field",
+		"TgTitleCleanRe":  "^Field - ",
+		"YtCheckInterval": "2h0m0s",
+		"TgMode":          "both",
+		"TgAudioCodec":    "opus",
+		"TgLoudnessLufs":  "-16",
+		"TgCoverMode":     "blur",
+		"TgRemovedMode":   "note",
+	}
+	for _, field := range TgSettingsEdits {
+		value, err := ChannelGet(channel, field)
+		if err != nil {
+			t.Errorf("%s %v", field, err)
+			continue
+		}
+		if value != values[field] {
+			t.Errorf("%s [%s] expected [%s]", field, value, values[field])
+			continue
+		}
+		// the rendered value is taken back by ChannelSet
+		newchannel, err := ChannelSet(channel, field, value)
+		if err != nil {
+			t.Errorf("%s [%s] %v", field, value, err)
+			continue
+		}
+		if newvalue, _ := ChannelGet(newchannel, field); newvalue != value {
+			t.Errorf("%s [%s] set [%s]", field, value, newvalue)
+		}
+	}
+	if _, err := ChannelGet(channel, "NoSuchField"); err == nil {
+		t.Errorf("NoSuchField no error")
+	}
+}
+
+func TestWebSubSignatureValid(t *testing.T) {
+	body := []byte("The quick brown fox jumps over the lazy dog")
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		body      []byte
+		valid     bool
+	}{
+		{"sha1", "key", "sha1=de7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9", body, true},
+		{"sha256", "key", "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", body, true},
+		{"sha256 upper hex", "key", "sha256=F7BC83F430538424B13298E6AA6FB143EF4D59A14946175997479DBC2D1A3CD8", body, true},
+		{"wrong secret", "other", "sha1=de7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9", body, false},
+		{"changed body", "key", "sha1=de7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9", []byte("The quick brown fox jumps over the lazy cat"), false},
+		{"unknown method", "key", "md5=80070713463e7749b90c2dc24911e275", body, false},
+		{"no method", "key", "de7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9", body, false},
+		{"bad hex", "key", "sha1=zz7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9", body, false},
+		{"empty", "key", "", body, false},
+	}
+	for _, tt := range tests {
+		if valid := WebSubSignatureValid(tt.secret, tt.signature, tt.body); valid != tt.valid {
+			t.Errorf("%s valid <%v> want <%v>", tt.name, valid, tt.valid)
+		}
+	}
+}
+
+func TestFlacPictureBlock(t *testing.T) {
+	picture := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00 picture bytes")
+	block, err := base64.StdEncoding.DecodeString(flacPictureBlock(picture, 320, 180))
+	if err != nil {
+		t.Fatalf("base64 %v", err)
+	}
+
+	r := bytes.NewReader(block)
+	u32 := func() uint32 {
+		var v uint32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			t.Fatalf("binary.Read %v", err)
+		}
+		return v
+	}
+	str := func(n uint32) string {
+		b := make([]byte, n)
+		if _, err := r.Read(b); err != nil {
+			t.Fatalf("Read %v", err)
+		}
+		return string(b)
+	}
+
+	if v := u32(); v != 3 {
+		t.Errorf("picture type <%d> want front cover <3>", v)
+	}
+	if mime := str(u32()); mime != "image/jpeg" {
+		t.Errorf("mime [%s] want [image/jpeg]", mime)
+	}
+	if description := str(u32()); description != "" {
+		t.Errorf("description [%s] want empty", description)
+	}
+	if w, h := u32(), u32(); w != 320 || h != 180 {
+		t.Errorf("size <%dx%d> want <320x180>", w, h)
+	}
+	if depth, colors := u32(), u32(); depth != 24 || colors != 0 {
+		t.Errorf("depth <%d> colors <%d>", depth, colors)
+	}
+	if data := str(u32()); data != string(picture) {
+		t.Errorf("picture data [%q] want [%q]", data, picture)
+	}
+	if r.Len() != 0 {
+		t.Errorf("<%d> bytes left", r.Len())
+	}
+}
+
+func TestCenterSquare(t *testing.T) {
+	tests := []struct {
+		r, square image.Rectangle
+	}{
+		{image.Rect(0, 0, 1280, 720), image.Rect(280, 0, 1000, 720)},
+		{image.Rect(0, 0, 720, 1280), image.Rect(0, 280, 720, 1000)},
+		{image.Rect(0, 0, 320, 320), image.Rect(0, 0, 320, 320)},
+		{image.Rect(10, 20, 30, 60), image.Rect(10, 30, 30, 50)},
+		{image.Rect(0, 0, 481, 360), image.Rect(60, 0, 420, 360)},
+	}
+	for _, tt := range tests {
+		if square := centerSquare(tt.r); square != tt.square {
+			t.Errorf("centerSquare %v %v want %v", tt.r, square, tt.square)
+		}
+	}
+}
+
+func TestFileConfigStorePut(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+		err       error
+	}{
+		{"revision checked", false, ErrConfigConflict},
+		{"overwrite", true, nil},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "tgtubechan.state.yaml")
+		if err := os.WriteFile(path, []byte("TgUpdateLog: [1]\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		store := &FileConfigStore{Path: path, Overwrite: tt.overwrite}
+		var state TgTubeChanState
+		if err := store.Get(&state); err != nil {
+			t.Fatalf("%s Get %v", tt.name, err)
+		}
+
+		// written by somebody else meanwhile
+		touched := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, touched, touched); err != nil {
+			t.Fatal(err)
+		}
+
+		state.TgUpdateLog = append(state.TgUpdateLog, 2)
+		if err := store.Put(&state); !errors.Is(err, tt.err) {
+			t.Errorf("%s Put %v want %v", tt.name, err, tt.err)
+		}
+		// the next put goes on the revision of the last one
+		if tt.err == nil {
+			if err := store.Put(&state); err != nil {
+				t.Errorf("%s second Put %v", tt.name, err)
+			}
+		}
+	}
+}